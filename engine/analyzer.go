@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is an analyzed term and the byte range of its surface form, so
+// highlighting can mark every form of a stemmed query term
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into index terms: runs of letters and digits, joined
+// by inner hyphens or underscores like the C++ tokenizer keeps them,
+// lowercased (Cyrillic included) with ё folded into е, and stemmed
+func Tokenize(text string) []Token {
+	var tokens []Token
+	var cur strings.Builder
+	start, end := -1, 0
+	pendingJoin := rune(0)
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, Token{Term: Stem(cur.String()), Start: start, End: end})
+			cur.Reset()
+		}
+		start = -1
+		pendingJoin = 0
+	}
+
+	for i, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if pendingJoin != 0 {
+				cur.WriteRune(pendingJoin)
+				pendingJoin = 0
+			}
+			if start < 0 {
+				start = i
+			}
+			end = i + utf8.RuneLen(r)
+			r = unicode.ToLower(r)
+			if r == 'ё' {
+				r = 'е'
+			}
+			cur.WriteRune(r)
+		case (r == '-' || r == '_') && cur.Len() > 0 && pendingJoin == 0:
+			pendingJoin = r
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Analyze returns the index terms of text, see Tokenize
+func Analyze(text string) []string {
+	tokens := Tokenize(text)
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.Term
+	}
+	return terms
+}
+
+// AnalyzeTerm normalizes a single query term the way Analyze normalizes
+// document text. A term that splits into several words is rejoined with
+// hyphens so it stays one lookup key.
+func AnalyzeTerm(term string) string {
+	return strings.Join(Analyze(term), "-")
+}
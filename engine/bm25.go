@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BM25 holds the ranking parameters: K1 controls term frequency saturation,
+// B how strongly frequencies are normalized by field length
+type BM25 struct {
+	K1 float64
+	B  float64
+}
+
+// DefaultBM25 are the usual Robertson/Okapi settings
+var DefaultBM25 = BM25{K1: 1.2, B: 0.75}
+
+// IDF is the BM25 inverse document frequency, kept non-negative for terms
+// that occur in more than half of the documents
+func (p BM25) IDF(df, numDocs int) float64 {
+	return math.Log(1 + (float64(numDocs)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// FieldFreq is a term frequency normalized by the field length, as BM25F
+// does before weighting and summing the fields
+func (p BM25) FieldFreq(freq float64, fieldLen int, avgLen float64) float64 {
+	norm := 1 - p.B
+	if avgLen > 0 {
+		norm += p.B * float64(fieldLen) / avgLen
+	}
+	if norm <= 0 {
+		return freq
+	}
+	return freq / norm
+}
+
+// Saturate is the frequency part of the score for the weighted sum of
+// normalized field frequencies
+func (p BM25) Saturate(freq float64) float64 {
+	return freq * (p.K1 + 1) / (freq + p.K1)
+}
+
+// FieldHit is how often a clause matched in one field of a document
+type FieldHit struct {
+	Field string `json:"field"`
+	Freq  uint32 `json:"freq"`
+}
+
+// TermScore is the contribution of one query clause to a document's score
+type TermScore struct {
+	Term   string     `json:"term"`
+	Fields []FieldHit `json:"fields"`
+	Freq   uint32     `json:"freq"`
+	// PseudoFreq is the weighted, length-normalized frequency over fields
+	PseudoFreq float64 `json:"pseudo_freq"`
+	DF         int     `json:"df"`
+	IDF        float64 `json:"idf"`
+	Weight     float64 `json:"weight"`
+	Score      float64 `json:"score"`
+}
+
+// ScoredDoc is a ranked search hit. Title and Snippet are only filled when
+// snippets were asked for.
+type ScoredDoc struct {
+	Doc     *IndexedDoc
+	Score   float64
+	Length  int
+	Terms   []TermScore
+	Title   Passage
+	Snippet []Passage
+}
+
+// SearchResult is one page of ranked hits
+type SearchResult struct {
+	Query []string
+	// Total counts every document matching the query
+	Total int
+	Hits  []ScoredDoc
+	// Facets counts the facet values over all Total documents
+	Facets []FacetResult
+}
+
+// SearchOptions selects what Search returns. FieldWeights are the BM25F
+// weights by field name; fields left out keep their default weight.
+type SearchOptions struct {
+	BM25         BM25
+	FieldWeights map[string]float64
+	Offset       int
+	Limit        int
+	// Snippets, if set, adds highlighted passages to every hit
+	Snippets *SnippetOptions
+
+	// Source keeps only documents of one source. From and To, when set,
+	// keep documents published in [From, To); undated documents drop out.
+	Source string
+	From   time.Time
+	To     time.Time
+
+	// Facets names the facets to count; FacetLimit caps the values of
+	// each, DefaultFacetLimit if zero
+	Facets     []string
+	FacetLimit int
+}
+
+type accumulator struct {
+	id    uint32
+	score float64
+	terms []TermScore
+}
+
+// fieldFreqs holds the frequency of a clause in each field of a document
+type fieldFreqs [numFields]uint32
+
+// Search ranks documents with BM25F: the frequency of a clause in each field
+// is normalized by the field length, weighted by the field weight and summed
+// before saturation, so a headline match outranks a passing mention in the
+// body. Plain terms are optional; phrase, NEAR and field:term clauses are
+// required. Phrases and NEAR are verified against positions and scored as one
+// unit each, with their match count as frequency. Scores are accumulated
+// clause at a time; only the best Offset+Limit documents are kept, in a
+// min-heap.
+//
+// Drill-down terms like @source:hltv or @month:2024-07 filter the matches
+// (see ParseFacetFilters). A query of filters alone lists every document
+// that passes them, unranked.
+func (ix *Index) Search(query string, opts SearchOptions) (*SearchResult, error) {
+	if opts.Offset < 0 {
+		return nil, &QueryError{Err: errors.New("offset must not be negative")}
+	}
+	text, filters, err := ParseFacetFilters(query)
+	if err != nil {
+		return nil, &QueryError{Err: err}
+	}
+	if opts.Source != "" {
+		filters.add(FacetSource, strings.ToLower(opts.Source))
+	}
+	clauses, err := ParseSearchQuery(text)
+	if err != nil {
+		return nil, &QueryError{Err: err}
+	}
+	weights, err := FieldWeights(opts.FieldWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SearchResult{}
+	counts := make(map[string]int)
+	var unique []Clause
+	for _, c := range clauses {
+		key := c.String()
+		res.Query = append(res.Query, key)
+		if counts[key] == 0 {
+			unique = append(unique, c)
+		}
+		counts[key]++
+	}
+	for _, f := range AllFacets {
+		for _, v := range filters[f] {
+			res.Query = append(res.Query, DrillTerm(f, v))
+		}
+	}
+	filtered := len(filters) > 0 || !opts.From.IsZero() || !opts.To.IsZero()
+	if len(clauses) == 0 && !filtered {
+		return res, nil
+	}
+	terms := highlightTerms(clauses)
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+
+	err = ix.View(func(r *IndexReader) error {
+		numDocs := r.NumDocs()
+		if numDocs == 0 {
+			return nil
+		}
+		var avgLens [numFields]float64
+		for i, f := range Fields {
+			avgLens[i] = float64(r.FieldTotalLength(f)) / float64(numDocs)
+		}
+
+		matches := make([]map[uint32]*fieldFreqs, len(unique))
+		var candidates map[uint32]bool
+		for i, c := range unique {
+			m, err := r.clauseFieldFreqs(c, weights)
+			if err != nil {
+				return err
+			}
+			matches[i] = m
+			if !c.Required() {
+				continue
+			}
+			// Documents have to satisfy every required clause
+			next := make(map[uint32]bool, len(m))
+			for doc := range m {
+				if candidates == nil || candidates[doc] {
+					next[doc] = true
+				}
+			}
+			candidates = next
+		}
+
+		facetValues := make(map[uint32][]string)
+		docFacets := func(doc uint32) []string {
+			values, ok := facetValues[doc]
+			if !ok {
+				values = r.DocFacets(doc)
+				facetValues[doc] = values
+			}
+			return values
+		}
+		keep := make(map[uint32]bool)
+		admitted := func(doc uint32) bool {
+			if candidates != nil && !candidates[doc] {
+				return false
+			}
+			if !filtered {
+				return true
+			}
+			if ok, seen := keep[doc]; seen {
+				return ok
+			}
+			ok := filters.matches(docFacets(doc))
+			if ok && (!opts.From.IsZero() || !opts.To.IsZero()) {
+				published, dated := r.Published(doc)
+				ok = dated && (opts.From.IsZero() || !published.Before(opts.From)) &&
+					(opts.To.IsZero() || published.Before(opts.To))
+			}
+			keep[doc] = ok
+			return ok
+		}
+
+		acc := make(map[uint32]*accumulator)
+		lengths := make(map[uint32]FieldLengths)
+		for i, c := range unique {
+			key := c.String()
+			df := len(matches[i])
+			idf := opts.BM25.IDF(df, numDocs)
+			for doc, freqs := range matches[i] {
+				if !admitted(doc) {
+					continue
+				}
+				docLens, ok := lengths[doc]
+				if !ok {
+					docLens = r.DocLengths(doc)
+					lengths[doc] = docLens
+				}
+
+				ts := TermScore{Term: key, DF: df, IDF: idf}
+				for f, n := range freqs {
+					if n == 0 {
+						continue
+					}
+					w := weights[f]
+					if c.Field != "" && w == 0 {
+						w = 1
+					}
+					ts.Fields = append(ts.Fields, FieldHit{Field: Fields[f], Freq: n})
+					ts.Freq += n
+					ts.PseudoFreq += w * opts.BM25.FieldFreq(float64(n), int(docLens[f]), avgLens[f])
+				}
+				ts.Weight = opts.BM25.Saturate(ts.PseudoFreq)
+				ts.Score = idf * ts.Weight * float64(counts[key])
+
+				a := acc[doc]
+				if a == nil {
+					a = &accumulator{id: doc}
+					acc[doc] = a
+				}
+				a.score += ts.Score
+				a.terms = append(a.terms, ts)
+			}
+		}
+		if len(clauses) == 0 {
+			for _, doc := range r.AllDocs() {
+				if admitted(doc) {
+					acc[doc] = &accumulator{id: doc}
+				}
+			}
+		}
+		res.Total = len(acc)
+		if len(opts.Facets) > 0 {
+			res.Facets = countFacets(acc, opts.Facets, opts.FacetLimit, query, filters, docFacets)
+		}
+
+		// Checked before adding, so a huge offset cannot overflow
+		if opts.Offset >= len(acc) {
+			return nil
+		}
+		top := topK(acc, opts.Offset+opts.Limit)
+		for _, a := range top[opts.Offset:] {
+			doc, err := r.Doc(a.id)
+			if err != nil {
+				return err
+			}
+			if doc == nil {
+				continue
+			}
+			hit := ScoredDoc{Doc: doc, Score: a.score, Length: lengths[a.id].Total(), Terms: a.terms}
+			if opts.Snippets != nil {
+				hit.Title = Highlight(doc.Title, terms)
+				text := doc.Paragraphs
+				if doc.Lead != "" {
+					text = append([]string{doc.Lead}, text...)
+				}
+				hit.Snippet = MakeSnippet(text, terms, *opts.Snippets)
+			}
+			res.Hits = append(res.Hits, hit)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// clauseFieldFreqs finds the documents matching a clause in the fields it
+// applies to: its own field, or every field with a non-zero weight
+func (r *IndexReader) clauseFieldFreqs(c Clause, weights [numFields]float64) (map[uint32]*fieldFreqs, error) {
+	out := make(map[uint32]*fieldFreqs)
+	for f, field := range Fields {
+		if c.Field != "" && c.Field != field || c.Field == "" && weights[f] == 0 {
+			continue
+		}
+
+		hit := func(doc, n uint32) {
+			freqs := out[doc]
+			if freqs == nil {
+				freqs = &fieldFreqs{}
+				out[doc] = freqs
+			}
+			freqs[f] = n
+		}
+
+		if c.Positional() {
+			m, err := r.ClauseMatches(c, field)
+			if err != nil {
+				return nil, err
+			}
+			for doc, n := range m {
+				hit(doc, n)
+			}
+			continue
+		}
+
+		list, err := r.FieldPostings(field, c.Terms[0], false)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			hit(p.Doc, p.Freq)
+		}
+	}
+	return out, nil
+}
+
+// scoreHeap is a min-heap on score, so the weakest of the current top k is
+// at the root; ties go to the lower doc id
+type scoreHeap []*accumulator
+
+func (h scoreHeap) Len() int { return len(h) }
+func (h scoreHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score < h[j].score
+	}
+	return h[i].id > h[j].id
+}
+func (h scoreHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoreHeap) Push(x interface{}) { *h = append(*h, x.(*accumulator)) }
+func (h *scoreHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topK returns the k best accumulators, best first
+func topK(acc map[uint32]*accumulator, k int) []*accumulator {
+	if k > len(acc) || k < 0 {
+		k = len(acc)
+	}
+	h := make(scoreHeap, 0, k)
+	for _, a := range acc {
+		if len(h) < k {
+			heap.Push(&h, a)
+		} else if better(a, h[0]) {
+			h[0] = a
+			heap.Fix(&h, 0)
+		}
+	}
+	out := make([]*accumulator, len(h))
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&h).(*accumulator)
+	}
+	for _, a := range out {
+		sort.Slice(a.terms, func(i, j int) bool { return a.terms[i].Score > a.terms[j].Score })
+	}
+	return out
+}
+
+func better(a, b *accumulator) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.id < b.id
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+
+	"corpus_parser/parser"
+)
+
+func TestBM25FTitleBoost(t *testing.T) {
+	ix := openTestIndex(t)
+	inTitle := testRecord("https://www.hltv.org/news/1/a", "navi win cologne", "donk zywoo ropz s1mple")
+	inBody := testRecord("https://www.hltv.org/news/2/b", "vitality win cologne", "donk zywoo navi s1mple")
+	other := testRecord("https://www.hltv.org/news/3/c", "faze win cologne", "donk zywoo ropz monesy")
+	if _, err := ix.Update([]*parser.ParsedRecord{inBody, inTitle, other}, nil); err != nil {
+		t.Fatal(err)
+	}
+	opts := SearchOptions{BM25: BM25{K1: 1.2, B: 0.75}, Limit: 10}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Same length and one mention each; only the field differs
+		{"navi", []string{inTitle.URL, inBody.URL}},
+		{"title:navi", []string{inTitle.URL}},
+		{"body:navi", []string{inBody.URL}},
+		{"title:navi donk", []string{inTitle.URL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res, err := ix.Search(tt.query, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, hit := range res.Hits {
+				got = append(got, hit.Doc.URL)
+			}
+			if len(got) != len(tt.want) || res.Total != len(tt.want) {
+				t.Fatalf("got %d of %d hits %v, want %v", len(got), res.Total, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("hit %d is %s, want %s", i+1, got[i], tt.want[i])
+				}
+			}
+			if len(res.Hits) == 2 && res.Hits[0].Score <= res.Hits[1].Score {
+				t.Errorf("title match scored %.4f, not above the body match at %.4f", res.Hits[0].Score, res.Hits[1].Score)
+			}
+		})
+	}
+
+	// The title weight is what puts the title match ahead
+	ratio := func(weights map[string]float64) float64 {
+		opts.FieldWeights = weights
+		res, err := ix.Search("navi", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Hits) != 2 {
+			t.Fatalf("%d hits for navi, want 2", len(res.Hits))
+		}
+		scores := make(map[string]float64)
+		for _, hit := range res.Hits {
+			scores[hit.Doc.URL] = hit.Score
+		}
+		return scores[inTitle.URL] / scores[inBody.URL]
+	}
+	if boosted, flat := ratio(nil), ratio(map[string]float64{FieldTitle: 1}); boosted <= flat {
+		t.Errorf("title over body score ratio %.3f with the default weights, %.3f with equal ones", boosted, flat)
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"corpus_parser/parser"
+)
+
+// Hit is a matching document joined with its manifest entry. URL and Title
+// are empty when the manifest does not know the id.
+type Hit struct {
+	ID     uint32
+	DocKey string
+	Source string
+	URL    string
+	Title  string
+}
+
+// BooleanEngine answers boolean queries over a BOOLEAN_INDEX file and maps
+// the doc ids back to articles through the doc id manifest
+type BooleanEngine struct {
+	Index    *BooleanIndex
+	Manifest *parser.Manifest
+}
+
+func OpenBooleanEngine(indexPath, manifestPath string) (*BooleanEngine, error) {
+	idx, err := LoadBooleanIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := parser.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	return &BooleanEngine{Index: idx, Manifest: manifest}, nil
+}
+
+// Search parses and evaluates query and returns all matching documents in
+// doc id order
+func (e *BooleanEngine) Search(query string) ([]Hit, error) {
+	q, err := ParseQuery(query, NormalizeTerm)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := Evaluate(e.Index, q)
+	hits := make([]Hit, 0, len(ids))
+	for _, id := range ids {
+		hit := Hit{ID: id}
+		if entry := e.Manifest.Lookup(int(id)); entry != nil {
+			hit.DocKey = entry.DocKey
+			hit.Source = entry.Source
+			hit.URL = entry.URL
+			hit.Title = entry.Title
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const booleanIndexHeader = "BOOLEAN_INDEX"
+
+// BooleanIndex is an inverted index loaded from the text format written by
+// the C++ index_builder: a BOOLEAN_INDEX header line, the doc count, the term
+// count, then one "term: id id ..." line per term
+type BooleanIndex struct {
+	DocCount int
+	postings map[string]Postings
+}
+
+// LoadBooleanIndex reads an index file into sorted, deduplicated posting lists
+func LoadBooleanIndex(path string) (*BooleanIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+
+	var header [3]string
+	for i := range header {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: truncated header", path)
+		}
+		header[i] = strings.TrimSpace(scanner.Text())
+	}
+	if header[0] != booleanIndexHeader {
+		return nil, fmt.Errorf("%s: not a %s file", path, booleanIndexHeader)
+	}
+	docCount, err := strconv.Atoi(header[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad doc count: %w", path, err)
+	}
+	termCount, err := strconv.Atoi(header[2])
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad term count: %w", path, err)
+	}
+
+	idx := &BooleanIndex{DocCount: docCount, postings: make(map[string]Postings, termCount)}
+	line := 3
+	for scanner.Scan() {
+		line++
+		term, ids, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(ids)
+		list := make(Postings, 0, len(fields))
+		for _, field := range fields {
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad doc id %q", path, line, field)
+			}
+			list = append(list, uint32(id))
+		}
+		idx.postings[term] = normalizePostings(list)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(idx.postings) != termCount {
+		fmt.Printf("Warning: %s declares %d terms but has %d\n", path, termCount, len(idx.postings))
+	}
+	return idx, nil
+}
+
+// normalizePostings sorts a list and drops duplicate ids
+func normalizePostings(list Postings) Postings {
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	out := list[:0]
+	for i, id := range list {
+		if i == 0 || id != list[i-1] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Postings returns the posting list of a term, already normalized the way
+// the C++ tokenizer does
+func (idx *BooleanIndex) Postings(term string) Postings {
+	return idx.postings[term]
+}
+
+func (idx *BooleanIndex) TermCount() int {
+	return len(idx.postings)
+}
+
+// AllDocs returns 0..DocCount-1, the ids index_builder assigns
+func (idx *BooleanIndex) AllDocs() Postings {
+	return All(idx.DocCount)
+}
+
+// NormalizeTerm lowercases ASCII letters only, like the C++ tools, which
+// store non-ASCII bytes as they are
+func NormalizeTerm(term string) string {
+	b := []byte(term)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 32
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadBooleanIndex(t *testing.T) {
+	idx, err := LoadBooleanIndex(filepath.Join("testdata", "boolean_index.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.DocCount != 6 || idx.TermCount() != 4 {
+		t.Errorf("loaded %d docs and %d terms, want 6 and 4", idx.DocCount, idx.TermCount())
+	}
+	// Lists come back sorted and without the duplicate ids of the file
+	if got := idx.Postings("navi"); !reflect.DeepEqual(got, Postings{0, 3, 5}) {
+		t.Errorf("navi postings %v, want [0 3 5]", got)
+	}
+	if got := idx.Postings("major"); !reflect.DeepEqual(got, Postings{0, 1, 3}) {
+		t.Errorf("major postings %v, want [0 1 3]", got)
+	}
+
+	bad := []struct {
+		name string
+		data string
+	}{
+		{"wrong header", "INDEX\n1\n0\n"},
+		{"truncated header", "BOOLEAN_INDEX\n1\n"},
+		{"bad doc count", "BOOLEAN_INDEX\nsix\n0\n"},
+		{"bad term count", "BOOLEAN_INDEX\n1\nfour\n"},
+		{"bad doc id", "BOOLEAN_INDEX\n2\n1\nnavi: 0 x\n"},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "index.idx")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadBooleanIndex(path); err == nil {
+				t.Error("loaded without an error")
+			}
+		})
+	}
+}
+
+func TestEvaluateBooleanIndex(t *testing.T) {
+	idx, err := LoadBooleanIndex(filepath.Join("testdata", "boolean_index.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  Postings
+	}{
+		{"NaVi", Postings{0, 3, 5}},
+		{"navi and major", Postings{0, 3}},
+		{"navi major cs2", nil},
+		{"navi or faze", Postings{0, 2, 3, 5}},
+		{"cs2 or unknown", Postings{4}},
+		{"navi -faze", Postings{0, 3}},
+		{"navi and not major", Postings{5}},
+		{"(navi or faze) -major", Postings{2, 5}},
+		// Wholly negative queries are taken against every doc id
+		{"not navi", Postings{1, 2, 4}},
+		{"not (navi or faze)", Postings{1, 4}},
+		{"not unknown", Postings{0, 1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query, NormalizeTerm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Evaluate(idx, q)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
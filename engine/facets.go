@@ -0,0 +1,325 @@
+package engine
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"corpus_parser/parser"
+)
+
+// Facets a search can count and filter by
+const (
+	FacetSource = "source"
+	FacetTag    = "tag"
+	FacetYear   = "year"
+	FacetMonth  = "month"
+	FacetEntity = "entity"
+)
+
+// AllFacets lists the facets in output order
+var AllFacets = []string{FacetSource, FacetTag, FacetYear, FacetMonth, FacetEntity}
+
+// DefaultFacetLimit caps the values shown for source, tag and entity;
+// years and months are always shown in full
+const DefaultFacetLimit = 10
+
+func isFacet(name string) bool {
+	for _, f := range AllFacets {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFacetNames checks a comma separated facet list; "all" selects every
+// facet
+func ParseFacetNames(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		switch {
+		case name == "":
+		case name == "all":
+			return AllFacets, nil
+		case isFacet(name):
+			names = append(names, name)
+		default:
+			return nil, fmt.Errorf("unknown facet %q (facets: %s)", name, strings.Join(AllFacets, ", "))
+		}
+	}
+	return names, nil
+}
+
+// EntityMatcher finds dictionary entities in article text. Every entity has
+// a canonical name and aliases; aliases go through the analyzer, so they
+// match whatever the inflection (навишники, навишникам).
+type EntityMatcher struct {
+	aliases []entityAlias
+	byFirst map[string][]int
+	version string
+}
+
+type entityAlias struct {
+	name  string
+	terms []string
+}
+
+// NewEntityMatcher compiles a dictionary of canonical name to aliases. The
+// name itself always counts as an alias. Names are lowercased, like the
+// values of @entity: drill-downs.
+func NewEntityMatcher(dict map[string][]string) *EntityMatcher {
+	m := &EntityMatcher{byFirst: make(map[string][]int)}
+	lowered := make(map[string][]string, len(dict))
+	for name, aliases := range dict {
+		name = strings.ToLower(strings.TrimSpace(name))
+		lowered[name] = append(lowered[name], aliases...)
+	}
+	names := make([]string, 0, len(lowered))
+	for name := range lowered {
+		sort.Strings(lowered[name])
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha1.New()
+	for _, name := range names {
+		aliases := append([]string{name}, lowered[name]...)
+		fmt.Fprintf(h, "%s=%s\n", name, strings.Join(lowered[name], "|"))
+		for _, alias := range aliases {
+			terms := Analyze(alias)
+			if len(terms) == 0 {
+				continue
+			}
+			m.byFirst[terms[0]] = append(m.byFirst[terms[0]], len(m.aliases))
+			m.aliases = append(m.aliases, entityAlias{name: name, terms: terms})
+		}
+	}
+	if len(names) > 0 {
+		m.version = hex.EncodeToString(h.Sum(nil))[:8]
+	}
+	return m
+}
+
+// Version identifies the dictionary, so documents are re-indexed when it
+// changes; empty when there is none
+func (m *EntityMatcher) Version() string {
+	if m == nil {
+		return ""
+	}
+	return m.version
+}
+
+// Find returns the canonical names of the entities mentioned in texts
+func (m *EntityMatcher) Find(texts []string) []string {
+	if m == nil || len(m.aliases) == 0 {
+		return nil
+	}
+	found := make(map[string]bool)
+	for _, text := range texts {
+		terms := Analyze(text)
+		for i, t := range terms {
+			for _, a := range m.byFirst[t] {
+				alias := m.aliases[a]
+				if found[alias.name] || i+len(alias.terms) > len(terms) {
+					continue
+				}
+				match := true
+				for j, at := range alias.terms[1:] {
+					if terms[i+1+j] != at {
+						match = false
+						break
+					}
+				}
+				if match {
+					found[alias.name] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// facetValue is the stored form of a facet value, "month:2024-07"
+func facetValue(facet, value string) string {
+	return facet + ":" + value
+}
+
+// docFacets returns the facet values of a record in stored form
+func docFacets(r *parser.ParsedRecord, entities *EntityMatcher) []string {
+	values := []string{facetValue(FacetSource, r.Source)}
+	seen := make(map[string]bool)
+	for _, tag := range r.Metadata.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			values = append(values, facetValue(FacetTag, tag))
+		}
+	}
+	// The article's own offset decides the month, like for date filters
+	if published, ok := localPublished(r.Metadata.Published); ok {
+		values = append(values,
+			facetValue(FacetYear, published.Format("2006")),
+			facetValue(FacetMonth, published.Format("2006-01")))
+	}
+	texts := append([]string{r.Title, r.Lead}, r.Paragraphs...)
+	texts = append(texts, r.Metadata.Tags...)
+	for _, name := range entities.Find(texts) {
+		values = append(values, facetValue(FacetEntity, name))
+	}
+	return values
+}
+
+// FacetFilter holds drill-down values by facet. A document has to match one
+// value of every facet named.
+type FacetFilter map[string][]string
+
+func (f FacetFilter) has(facet, value string) bool {
+	for _, v := range f[facet] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f FacetFilter) add(facet, value string) {
+	if !f.has(facet, value) {
+		f[facet] = append(f[facet], value)
+	}
+}
+
+// matches reports whether a document with the stored facet values passes
+func (f FacetFilter) matches(values []string) bool {
+	for facet, wanted := range f {
+		ok := false
+		for _, w := range wanted {
+			for _, v := range values {
+				if v == facetValue(facet, w) {
+					ok = true
+					break
+				}
+			}
+			if ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+var facetSyntax = regexp.MustCompile(`(?:^|\s)@([a-z]+):("[^"]*"|[^\s"]+)`)
+
+// ParseFacetFilters takes the drill-down terms out of a search query:
+// @source:hltv, @tag:"natus vincere", @year:2024, @month:2024-07 and
+// @entity:s1mple. It returns the rest of the query as text.
+func ParseFacetFilters(query string) (string, FacetFilter, error) {
+	filters := make(FacetFilter)
+	var err error
+	text := facetSyntax.ReplaceAllStringFunc(query, func(s string) string {
+		m := facetSyntax.FindStringSubmatch(s)
+		if !isFacet(m[1]) {
+			if err == nil {
+				err = fmt.Errorf("unknown facet @%s (facets: %s)", m[1], strings.Join(AllFacets, ", "))
+			}
+			return s
+		}
+		value := strings.ToLower(strings.TrimSpace(strings.Trim(m[2], `"`)))
+		if value != "" {
+			filters.add(m[1], value)
+		}
+		return " "
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(text), filters, nil
+}
+
+// DrillTerm is the query syntax that narrows a search to one facet value
+func DrillTerm(facet, value string) string {
+	if strings.ContainsAny(value, " \t\"") {
+		value = `"` + strings.ReplaceAll(value, `"`, "") + `"`
+	}
+	return "@" + facet + ":" + value
+}
+
+// FacetCount is how many matching documents have one facet value. Drill is
+// the query that narrows the search to them.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	Drill string `json:"drill"`
+}
+
+// FacetResult holds the counts of one facet over every document matching a
+// search, not only the page returned
+type FacetResult struct {
+	Facet  string       `json:"facet"`
+	Values []FacetCount `json:"values"`
+	// Other sums the counts of the values left out by the limit
+	Other int `json:"other,omitempty"`
+}
+
+// countFacets aggregates the facet values of the matching documents. Drill
+// queries add the value to query unless the filters already hold it.
+func countFacets(docs map[uint32]*accumulator, facets []string, limit int, query string, filters FacetFilter, values func(uint32) []string) []FacetResult {
+	counts := make(map[string]map[string]int, len(facets))
+	for _, f := range facets {
+		counts[f] = make(map[string]int)
+	}
+	for id := range docs {
+		for _, v := range values(id) {
+			facet, value, _ := strings.Cut(v, ":")
+			if c := counts[facet]; c != nil {
+				c[value]++
+			}
+		}
+	}
+
+	if limit <= 0 {
+		limit = DefaultFacetLimit
+	}
+	results := make([]FacetResult, 0, len(facets))
+	for _, f := range facets {
+		res := FacetResult{Facet: f, Values: []FacetCount{}}
+		for value, n := range counts[f] {
+			drill := strings.TrimSpace(query)
+			if !filters.has(f, value) {
+				drill = strings.TrimSpace(drill + " " + DrillTerm(f, value))
+			}
+			res.Values = append(res.Values, FacetCount{Value: value, Count: n, Drill: drill})
+		}
+		if f == FacetYear || f == FacetMonth {
+			sort.Slice(res.Values, func(i, j int) bool { return res.Values[i].Value < res.Values[j].Value })
+		} else {
+			sort.Slice(res.Values, func(i, j int) bool {
+				a, b := res.Values[i], res.Values[j]
+				if a.Count != b.Count {
+					return a.Count > b.Count
+				}
+				return a.Value < b.Value
+			})
+			if len(res.Values) > limit {
+				for _, v := range res.Values[limit:] {
+					res.Other += v.Count
+				}
+				res.Values = res.Values[:limit]
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
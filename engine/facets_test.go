@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"corpus_parser/parser"
+)
+
+func TestDocFacets(t *testing.T) {
+	entities := NewEntityMatcher(map[string][]string{
+		"Natus Vincere": {"navi"},
+		"ZywOo":         nil,
+	})
+	r := &parser.ParsedRecord{
+		Source:     "cybersport",
+		Title:      "NAVI beat Vitality",
+		Paragraphs: []string{"zywoo top fragged"},
+		Metadata: parser.ArticleMetadata{
+			Tags: []string{"CS2", " Major "},
+			// 21:30 UTC on July 31st, already August in Moscow
+			Published: "2024-08-01T00:30:00+03:00",
+		},
+	}
+	want := []string{
+		"source:cybersport",
+		"tag:cs2", "tag:major",
+		"year:2024", "month:2024-08",
+		"entity:natus vincere", "entity:zywoo",
+	}
+	values := docFacets(r, entities)
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("got %q, want %q", values, want)
+	}
+
+	// Drill-down values are lowercased, so they have to match as stored
+	_, filters, err := ParseFacetFilters(`@entity:"Natus Vincere" @entity:ZywOo @month:2024-08`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for facet, vs := range filters {
+		for _, v := range vs {
+			if !(FacetFilter{facet: {v}}).matches(values) {
+				t.Errorf("@%s:%s does not match the document", facet, v)
+			}
+		}
+	}
+}
+
+// Date filters and month facets put an article on the same day, the one of
+// its own offset
+func TestDateFiltersFollowMonthFacet(t *testing.T) {
+	ix := openTestIndex(t)
+	moscow := testRecord("https://www.hltv.org/news/1/a", "navi major", "donk")
+	moscow.Metadata.Published = "2024-08-01T00:30:00+03:00"
+	utc := testRecord("https://www.hltv.org/news/2/b", "navi cologne", "s1mple")
+	utc.Metadata.Published = "2024-07-31T23:30:00Z"
+	if _, err := ix.Update([]*parser.ParsedRecord{moscow, utc}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	august := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		query    string
+		from, to time.Time
+		want     string
+	}{
+		{"to is exclusive", "navi", time.Time{}, august, utc.URL},
+		{"from", "navi", august, time.Time{}, moscow.URL},
+		{"august", "navi @month:2024-08", time.Time{}, time.Time{}, moscow.URL},
+		{"july", "navi @month:2024-07", time.Time{}, time.Time{}, utc.URL},
+		{"august and from", "navi @month:2024-08", august, time.Time{}, moscow.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ix.Search(tt.query, SearchOptions{BM25: BM25{K1: 1.2, B: 0.75}, Limit: 10, From: tt.from, To: tt.to})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Hits) != 1 || res.Hits[0].Doc.URL != tt.want {
+				var got []string
+				for _, hit := range res.Hits {
+					got = append(got, hit.Doc.URL)
+				}
+				t.Errorf("got %v, want only %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"corpus_parser/parser"
+)
+
+// Indexed fields of an article
+const (
+	FieldTitle  = "title"
+	FieldLead   = "lead"
+	FieldBody   = "body"
+	FieldTags   = "tags"
+	FieldSource = "source"
+)
+
+// Fields lists the indexed fields in storage order
+var Fields = []string{FieldTitle, FieldLead, FieldBody, FieldTags, FieldSource}
+
+const numFields = 5
+
+// DefaultFieldWeights make a headline match count three times a body match
+var DefaultFieldWeights = map[string]float64{
+	FieldTitle:  3,
+	FieldLead:   2,
+	FieldBody:   1,
+	FieldTags:   2,
+	FieldSource: 1,
+}
+
+// FieldLengths holds the number of terms of each field of a document
+type FieldLengths [numFields]uint32
+
+func (l FieldLengths) Total() int {
+	total := 0
+	for _, n := range l {
+		total += int(n)
+	}
+	return total
+}
+
+func fieldIndex(field string) int {
+	for i, f := range Fields {
+		if f == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsField reports whether name is an indexed field
+func IsField(name string) bool {
+	return fieldIndex(name) >= 0
+}
+
+// FieldWeights checks configured BM25F weights and fills in defaults for
+// fields that are not mentioned
+func FieldWeights(configured map[string]float64) ([numFields]float64, error) {
+	var weights [numFields]float64
+	for i, f := range Fields {
+		weights[i] = DefaultFieldWeights[f]
+	}
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := fieldIndex(name)
+		if i < 0 {
+			return weights, fmt.Errorf("unknown search field %q (fields: %s)", name, strings.Join(Fields, ", "))
+		}
+		if configured[name] < 0 {
+			return weights, fmt.Errorf("weight of field %s must not be negative", name)
+		}
+		weights[i] = configured[name]
+	}
+	return weights, nil
+}
+
+// fieldValues returns the text values of every field of a record. Tags are
+// separate values, so a phrase never runs from one tag into the next.
+func fieldValues(r *parser.ParsedRecord) [numFields][]string {
+	var values [numFields][]string
+	values[0] = []string{r.Title}
+	values[1] = []string{r.Lead}
+	values[2] = r.Paragraphs
+	values[3] = r.Metadata.Tags
+	values[4] = []string{r.Source}
+	return values
+}
+
+// analyzeValues gives the positions of every term across the values of a
+// field, leaving a one position gap between values, and the field length
+func analyzeValues(values []string) (map[string][]uint32, int) {
+	positions := make(map[string][]uint32)
+	pos, length := 0, 0
+	for i, v := range values {
+		if i > 0 {
+			pos++
+		}
+		for _, t := range Analyze(v) {
+			positions[t] = append(positions[t], uint32(pos))
+			pos++
+			length++
+		}
+	}
+	return positions, length
+}
+
+// postingKey is the key of the posting list of term in field
+func postingKey(field, term string) string {
+	return field + ":" + term
+}
+
+func encodeLengths(l FieldLengths) []byte {
+	b := make([]byte, 4*numFields)
+	for i, n := range l {
+		binary.BigEndian.PutUint32(b[4*i:], n)
+	}
+	return b
+}
+
+func decodeLengths(b []byte) FieldLengths {
+	var l FieldLengths
+	if len(b) != 4*numFields {
+		return l
+	}
+	for i := range l {
+		l[i] = binary.BigEndian.Uint32(b[4*i:])
+	}
+	return l
+}
+
+func totalLengthKeyOf(field string) []byte {
+	return []byte("total_length:" + field)
+}
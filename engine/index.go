@@ -0,0 +1,737 @@
+package engine
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"corpus_parser/parser"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// IndexFormat is bumped whenever the on-disk layout changes; an index of
+// another format has to be rebuilt
+const IndexFormat = 10
+
+var (
+	metaBucket     = []byte("meta")
+	urlsBucket     = []byte("urls")
+	docsBucket     = []byte("docs")
+	forwardBucket  = []byte("forward")
+	lengthsBucket  = []byte("lengths")
+	keysBucket     = []byte("keys")
+	datesBucket    = []byte("dates")
+	facetsBucket   = []byte("facets")
+	postingsBucket = []byte("postings")
+
+	formatKey = []byte("format")
+)
+
+// Posting is one document of a term's posting list, with the token
+// positions of the term in that document
+type Posting struct {
+	Doc       uint32
+	Freq      uint32
+	Positions []uint32
+}
+
+// IndexedDoc is what the index keeps about a document besides its postings,
+// including the text that snippets are cut from
+type IndexedDoc struct {
+	ID         uint32   `json:"-"`
+	DocKey     string   `json:"doc_key"`
+	URL        string   `json:"url"`
+	Source     string   `json:"source"`
+	Title      string   `json:"title"`
+	Lead       string   `json:"lead,omitempty"`
+	Paragraphs []string `json:"paragraphs,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Published  string   `json:"published,omitempty"`
+	// Hash is the raw hash and extractor version the postings came from
+	Hash   string `json:"hash"`
+	Length int    `json:"length"`
+}
+
+// Index is the incremental inverted index kept in a bbolt file, with one
+// positional posting list per field and term (key "title:navi"). Documents
+// get ids that stay fixed across updates; a changed document has its old
+// postings removed through its forward term list before the new ones are
+// merged in.
+type Index struct {
+	db   *bolt.DB
+	path string
+	// Entities, if set, tags documents with the dictionary entities they
+	// mention for the entity facet
+	Entities *EntityMatcher
+}
+
+// IndexUpdate counts what one Update call did
+type IndexUpdate struct {
+	Added     int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// IndexStats describes an index
+type IndexStats struct {
+	Docs int
+	// Terms counts posting lists, one per field and term
+	Terms       int
+	TotalLength int64
+	Size        int64
+}
+
+// OpenIndex opens or creates the index at path. A read-only index shares the
+// file with other readers; the crawler only holds the write lock while it
+// applies a batch.
+func OpenIndex(path string, readOnly bool) (*Index, error) {
+	if !readOnly {
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no index at %s (run the index command first)", path)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 30 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s: %w", path, err)
+	}
+	ix := &Index{db: db, path: path}
+
+	if readOnly {
+		err = db.View(func(tx *bolt.Tx) error { return checkFormat(tx) })
+	} else {
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{metaBucket, urlsBucket, docsBucket, forwardBucket, lengthsBucket, keysBucket, datesBucket, facetsBucket, postingsBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			meta := tx.Bucket(metaBucket)
+			if meta.Get(formatKey) == nil {
+				return meta.Put(formatKey, encodeUint64(IndexFormat))
+			}
+			return checkFormat(tx)
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ix, nil
+}
+
+func checkFormat(tx *bolt.Tx) error {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return fmt.Errorf("index is empty")
+	}
+	if v := decodeUint64(meta.Get(formatKey)); v != IndexFormat {
+		return fmt.Errorf("index format %d, this build reads %d (run index -rebuild)", v, IndexFormat)
+	}
+	return nil
+}
+
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// indexHash identifies the parse a document's postings were built from
+func indexHash(r *parser.ParsedRecord, entities *EntityMatcher) string {
+	return fmt.Sprintf("%s:%d:%s", r.RawHash, r.ExtractorVersion, entities.Version())
+}
+
+// Update adds new and changed records and deletes the documents of removed
+// URLs, all in one transaction. Records whose hash matches the indexed one
+// are left alone.
+func (ix *Index) Update(records []*parser.ParsedRecord, removed []string) (IndexUpdate, error) {
+	var res IndexUpdate
+	err := ix.db.Update(func(tx *bolt.Tx) error {
+		b := newIndexBatch(tx)
+		b.entities = ix.Entities
+
+		for _, url := range removed {
+			deleted, err := b.remove(url)
+			if err != nil {
+				return err
+			}
+			if deleted {
+				res.Deleted++
+			}
+		}
+
+		// Only the last record of a URL counts within one batch
+		last := make(map[string]int, len(records))
+		for i, r := range records {
+			last[r.URL] = i
+		}
+
+		for i, r := range records {
+			if last[r.URL] != i {
+				continue
+			}
+			outcome, err := b.put(r)
+			if err != nil {
+				return err
+			}
+			switch outcome {
+			case putAdded:
+				res.Added++
+			case putUpdated:
+				res.Updated++
+			default:
+				res.Unchanged++
+			}
+		}
+
+		return b.commit()
+	})
+	return res, err
+}
+
+const (
+	putUnchanged = iota
+	putAdded
+	putUpdated
+)
+
+// indexBatch collects the posting changes of one transaction per term, so
+// each posting list is rewritten once however many documents touch it
+type indexBatch struct {
+	tx      *bolt.Tx
+	urls    *bolt.Bucket
+	docs    *bolt.Bucket
+	forward *bolt.Bucket
+	lengths *bolt.Bucket
+	keys    *bolt.Bucket
+	dates   *bolt.Bucket
+	facets  *bolt.Bucket
+
+	entities     *EntityMatcher
+	removals     map[string]map[uint32]bool
+	additions    map[string][]Posting
+	totalLengths [numFields]int64
+}
+
+func newIndexBatch(tx *bolt.Tx) *indexBatch {
+	b := &indexBatch{
+		tx:        tx,
+		urls:      tx.Bucket(urlsBucket),
+		docs:      tx.Bucket(docsBucket),
+		forward:   tx.Bucket(forwardBucket),
+		lengths:   tx.Bucket(lengthsBucket),
+		keys:      tx.Bucket(keysBucket),
+		dates:     tx.Bucket(datesBucket),
+		facets:    tx.Bucket(facetsBucket),
+		removals:  make(map[string]map[uint32]bool),
+		additions: make(map[string][]Posting),
+	}
+	meta := tx.Bucket(metaBucket)
+	for i, f := range Fields {
+		b.totalLengths[i] = int64(decodeUint64(meta.Get(totalLengthKeyOf(f))))
+	}
+	return b
+}
+
+// unindex schedules removal of the postings of id and forgets its lengths
+func (b *indexBatch) unindex(id uint32) {
+	key := encodeID(id)
+	if data := b.forward.Get(key); data != nil {
+		for _, k := range strings.Split(string(data), "\n") {
+			if b.removals[k] == nil {
+				b.removals[k] = make(map[uint32]bool)
+			}
+			b.removals[k][id] = true
+		}
+	}
+	lengths := decodeLengths(b.lengths.Get(key))
+	for i, n := range lengths {
+		b.totalLengths[i] -= int64(n)
+	}
+}
+
+func (b *indexBatch) remove(url string) (bool, error) {
+	idBytes := b.urls.Get([]byte(url))
+	if idBytes == nil {
+		return false, nil
+	}
+	id := binary.BigEndian.Uint32(idBytes)
+	b.unindex(id)
+	key := encodeID(id)
+	var doc IndexedDoc
+	if err := json.Unmarshal(b.docs.Get(key), &doc); err != nil {
+		return false, err
+	}
+	if err := b.keys.Delete([]byte(doc.DocKey)); err != nil {
+		return false, err
+	}
+	if err := b.dates.Delete(key); err != nil {
+		return false, err
+	}
+	if err := b.facets.Delete(key); err != nil {
+		return false, err
+	}
+	if err := b.docs.Delete(key); err != nil {
+		return false, err
+	}
+	if err := b.forward.Delete(key); err != nil {
+		return false, err
+	}
+	if err := b.lengths.Delete(key); err != nil {
+		return false, err
+	}
+	return true, b.urls.Delete([]byte(url))
+}
+
+func (b *indexBatch) put(r *parser.ParsedRecord) (int, error) {
+	hash := indexHash(r, b.entities)
+	outcome := putAdded
+
+	var id uint32
+	if idBytes := b.urls.Get([]byte(r.URL)); idBytes != nil {
+		id = binary.BigEndian.Uint32(idBytes)
+		var prev IndexedDoc
+		if err := json.Unmarshal(b.docs.Get(idBytes), &prev); err != nil {
+			return 0, err
+		}
+		if prev.Hash == hash {
+			return putUnchanged, nil
+		}
+		b.unindex(id)
+		outcome = putUpdated
+	} else {
+		seq, err := b.docs.NextSequence()
+		if err != nil {
+			return 0, err
+		}
+		// Sequences start at 1; ids start at 0 like everywhere else
+		id = uint32(seq - 1)
+		if err := b.urls.Put([]byte(r.URL), encodeID(id)); err != nil {
+			return 0, err
+		}
+	}
+
+	var lengths FieldLengths
+	var keys []string
+	for i, values := range fieldValues(r) {
+		positions, length := analyzeValues(values)
+		lengths[i] = uint32(length)
+		b.totalLengths[i] += int64(length)
+		for t, pos := range positions {
+			k := postingKey(Fields[i], t)
+			keys = append(keys, k)
+			b.additions[k] = append(b.additions[k], Posting{Doc: id, Freq: uint32(len(pos)), Positions: pos})
+		}
+	}
+	sort.Strings(keys)
+
+	doc := IndexedDoc{
+		DocKey:     r.DocID,
+		URL:        r.URL,
+		Source:     r.Source,
+		Title:      r.Title,
+		Lead:       r.Lead,
+		Paragraphs: r.Paragraphs,
+		Tags:       r.Metadata.Tags,
+		Published:  r.Metadata.Published,
+		Hash:       hash,
+		Length:     lengths.Total(),
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return 0, err
+	}
+	key := encodeID(id)
+	if err := b.docs.Put(key, data); err != nil {
+		return 0, err
+	}
+	if err := b.forward.Put(key, []byte(strings.Join(keys, "\n"))); err != nil {
+		return 0, err
+	}
+	if err := b.lengths.Put(key, encodeLengths(lengths)); err != nil {
+		return 0, err
+	}
+	if err := b.keys.Put([]byte(r.DocID), key); err != nil {
+		return 0, err
+	}
+	if published, ok := localPublished(r.Metadata.Published); ok {
+		if err := b.dates.Put(key, encodeUint64(uint64(published.Unix()))); err != nil {
+			return 0, err
+		}
+	} else if err := b.dates.Delete(key); err != nil {
+		return 0, err
+	}
+	if err := b.facets.Put(key, []byte(strings.Join(docFacets(r, b.entities), "\n"))); err != nil {
+		return 0, err
+	}
+	return outcome, nil
+}
+
+// commit rewrites every touched posting list
+func (b *indexBatch) commit() error {
+	postings := b.tx.Bucket(postingsBucket)
+
+	touched := make(map[string]bool, len(b.removals)+len(b.additions))
+	for t := range b.removals {
+		touched[t] = true
+	}
+	for t := range b.additions {
+		touched[t] = true
+	}
+
+	for k := range touched {
+		key := []byte(k)
+		list, err := decodePostings(postings.Get(key), true)
+		if err != nil {
+			return fmt.Errorf("postings %q: %w", k, err)
+		}
+
+		if drop := b.removals[k]; len(drop) > 0 {
+			kept := list[:0]
+			for _, p := range list {
+				if !drop[p.Doc] {
+					kept = append(kept, p)
+				}
+			}
+			list = kept
+		}
+		if add := b.additions[k]; len(add) > 0 {
+			list = mergePostings(list, add)
+		}
+
+		if len(list) == 0 {
+			if err := postings.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := postings.Put(key, encodePostings(list)); err != nil {
+			return err
+		}
+	}
+
+	meta := b.tx.Bucket(metaBucket)
+	for i, f := range Fields {
+		if err := meta.Put(totalLengthKeyOf(f), encodeUint64(uint64(b.totalLengths[i]))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergePostings merges additions into a sorted list. Re-added ids replace
+// the old entries.
+func mergePostings(list, add []Posting) []Posting {
+	sort.Slice(add, func(i, j int) bool { return add[i].Doc < add[j].Doc })
+	out := make([]Posting, 0, len(list)+len(add))
+	i, j := 0, 0
+	for i < len(list) && j < len(add) {
+		switch {
+		case list[i].Doc < add[j].Doc:
+			out = append(out, list[i])
+			i++
+		case list[i].Doc > add[j].Doc:
+			out = append(out, add[j])
+			j++
+		default:
+			out = append(out, add[j])
+			i++
+			j++
+		}
+	}
+	out = append(out, list[i:]...)
+	return append(out, add[j:]...)
+}
+
+// Sync brings the index in line with the parsed articles of the store:
+// new and changed articles are indexed, articles gone from the store are
+// deleted
+func (ix *Index) Sync(store parser.DocumentStore) (IndexUpdate, error) {
+	var total IndexUpdate
+
+	indexed := make(map[string]bool)
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(k, _ []byte) error {
+			indexed[string(k)] = true
+			return nil
+		})
+	})
+	if err != nil {
+		return total, err
+	}
+
+	const syncBatch = 500
+	var batch []*parser.ParsedRecord
+	apply := func() error {
+		res, err := ix.Update(batch, nil)
+		total.Added += res.Added
+		total.Updated += res.Updated
+		total.Unchanged += res.Unchanged
+		batch = batch[:0]
+		return err
+	}
+
+	err = store.ForEachParsed(func(r *parser.ParsedRecord) error {
+		delete(indexed, r.URL)
+		batch = append(batch, r)
+		if len(batch) >= syncBatch {
+			return apply()
+		}
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+	if len(batch) > 0 {
+		if err := apply(); err != nil {
+			return total, err
+		}
+	}
+
+	if len(indexed) > 0 {
+		stale := make([]string, 0, len(indexed))
+		for url := range indexed {
+			stale = append(stale, url)
+		}
+		res, err := ix.Update(nil, stale)
+		total.Deleted = res.Deleted
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Stats reports the size of the index
+func (ix *Index) Stats() (IndexStats, error) {
+	var stats IndexStats
+	err := ix.View(func(r *IndexReader) error {
+		stats.Docs = r.NumDocs()
+		stats.Terms = r.tx.Bucket(postingsBucket).Stats().KeyN
+		stats.TotalLength = r.TotalLength()
+		stats.Size = r.tx.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// View runs fn against a consistent snapshot of the index
+func (ix *Index) View(fn func(*IndexReader) error) error {
+	return ix.db.View(func(tx *bolt.Tx) error {
+		return fn(&IndexReader{tx: tx})
+	})
+}
+
+// IndexReader reads one snapshot of the index. It is only valid inside the
+// View callback that produced it.
+type IndexReader struct {
+	tx  *bolt.Tx
+	all Postings
+}
+
+// FieldPostings returns the postings of an analyzed term in one field;
+// positions are only decoded when asked for
+func (r *IndexReader) FieldPostings(field, term string, positions bool) ([]Posting, error) {
+	return decodePostings(r.tx.Bucket(postingsBucket).Get([]byte(postingKey(field, term))), positions)
+}
+
+// Postings returns the doc ids with term in any field; decode errors read
+// as no match
+func (r *IndexReader) Postings(term string) Postings {
+	var ids Postings
+	for _, f := range Fields {
+		list, err := r.FieldPostings(f, term, false)
+		if err != nil {
+			return nil
+		}
+		fieldIDs := make(Postings, len(list))
+		for i, p := range list {
+			fieldIDs[i] = p.Doc
+		}
+		ids = Union(ids, fieldIDs)
+	}
+	return ids
+}
+
+// AllDocs returns the ids of every indexed document
+func (r *IndexReader) AllDocs() Postings {
+	if r.all == nil {
+		r.all = Postings{}
+		c := r.tx.Bucket(docsBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			r.all = append(r.all, binary.BigEndian.Uint32(k))
+		}
+	}
+	return r.all
+}
+
+// Doc returns the stored fields of a document, or nil if id is unknown
+func (r *IndexReader) Doc(id uint32) (*IndexedDoc, error) {
+	data := r.tx.Bucket(docsBucket).Get(encodeID(id))
+	if data == nil {
+		return nil, nil
+	}
+	doc := &IndexedDoc{ID: id}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DocByKey returns the document with a doc key such as hltv-38123, or nil
+func (r *IndexReader) DocByKey(docKey string) (*IndexedDoc, error) {
+	id := r.tx.Bucket(keysBucket).Get([]byte(docKey))
+	if id == nil {
+		return nil, nil
+	}
+	return r.Doc(binary.BigEndian.Uint32(id))
+}
+
+// DocByURL returns the document of a normalized URL, or nil
+func (r *IndexReader) DocByURL(url string) (*IndexedDoc, error) {
+	id := r.tx.Bucket(urlsBucket).Get([]byte(url))
+	if id == nil {
+		return nil, nil
+	}
+	return r.Doc(binary.BigEndian.Uint32(id))
+}
+
+// localPublished parses an RFC 3339 publication time and returns its wall
+// clock in the article's own offset, relabelled as UTC. Date filters and the
+// year and month facets both work on this, so a piece published at 00:30 on
+// the 1st in Moscow is on the 1st for either.
+func localPublished(value string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), true
+}
+
+// Published returns the publication time of a document as the article's own
+// wall clock (see localPublished); ok is false when the article had no date
+func (r *IndexReader) Published(id uint32) (t time.Time, ok bool) {
+	data := r.tx.Bucket(datesBucket).Get(encodeID(id))
+	if len(data) != 8 {
+		return t, false
+	}
+	return time.Unix(int64(decodeUint64(data)), 0).UTC(), true
+}
+
+// DocFacets returns the facet values of a document in "facet:value" form
+func (r *IndexReader) DocFacets(id uint32) []string {
+	data := r.tx.Bucket(facetsBucket).Get(encodeID(id))
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// DocLengths returns the field lengths of a document, zero if id is unknown
+func (r *IndexReader) DocLengths(id uint32) FieldLengths {
+	return decodeLengths(r.tx.Bucket(lengthsBucket).Get(encodeID(id)))
+}
+
+func (r *IndexReader) NumDocs() int {
+	return r.tx.Bucket(docsBucket).Stats().KeyN
+}
+
+// FieldTotalLength returns the number of terms of a field over all documents
+func (r *IndexReader) FieldTotalLength(field string) int64 {
+	return int64(decodeUint64(r.tx.Bucket(metaBucket).Get(totalLengthKeyOf(field))))
+}
+
+func (r *IndexReader) TotalLength() int64 {
+	var total int64
+	for _, f := range Fields {
+		total += r.FieldTotalLength(f)
+	}
+	return total
+}
+
+func encodeID(id uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], id)
+	return b[:]
+}
+
+func encodeUint64(v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return b[:]
+}
+
+func decodeUint64(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// encodePostings writes a posting list as uvarint doc id gaps, each followed
+// by the term frequency and that many position gaps
+func encodePostings(list []Posting) []byte {
+	buf := make([]byte, 0, len(list)*4)
+	var prev uint32
+	for _, p := range list {
+		buf = binary.AppendUvarint(buf, uint64(p.Doc-prev))
+		buf = binary.AppendUvarint(buf, uint64(p.Freq))
+		var prevPos uint32
+		for _, pos := range p.Positions {
+			buf = binary.AppendUvarint(buf, uint64(pos-prevPos))
+			prevPos = pos
+		}
+		prev = p.Doc
+	}
+	return buf
+}
+
+var errCorruptPostings = fmt.Errorf("corrupt posting list")
+
+// decodePostings reads a posting list; positions are skipped unless asked for
+func decodePostings(data []byte, positions bool) ([]Posting, error) {
+	var list []Posting
+	var doc uint64
+	for len(data) > 0 {
+		gap, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errCorruptPostings
+		}
+		data = data[n:]
+		freq, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errCorruptPostings
+		}
+		data = data[n:]
+		doc += gap
+
+		p := Posting{Doc: uint32(doc), Freq: uint32(freq)}
+		if positions {
+			p.Positions = make([]uint32, freq)
+		}
+		var pos uint64
+		for i := uint64(0); i < freq; i++ {
+			g, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errCorruptPostings
+			}
+			data = data[n:]
+			pos += g
+			if positions {
+				p.Positions[i] = uint32(pos)
+			}
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"corpus_parser/parser"
+)
+
+func TestPostingsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		list []Posting
+	}{
+		{"empty", nil},
+		{"single", []Posting{{Doc: 0, Freq: 1, Positions: []uint32{0}}}},
+		{"gaps", []Posting{
+			{Doc: 3, Freq: 2, Positions: []uint32{1, 7}},
+			{Doc: 4, Freq: 1, Positions: []uint32{0}},
+			{Doc: 900, Freq: 3, Positions: []uint32{2, 130, 131}},
+		}},
+		{"large ids", []Posting{
+			{Doc: 1 << 20, Freq: 1, Positions: []uint32{1 << 16}},
+			{Doc: 1<<32 - 1, Freq: 1, Positions: []uint32{5}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodePostings(tt.list)
+
+			got, err := decodePostings(data, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.list) {
+				t.Errorf("decoded %+v, want %+v", got, tt.list)
+			}
+
+			bare, err := decodePostings(data, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bare) != len(tt.list) {
+				t.Fatalf("decoded %d postings without positions, want %d", len(bare), len(tt.list))
+			}
+			for i, p := range bare {
+				if p.Doc != tt.list[i].Doc || p.Freq != tt.list[i].Freq || p.Positions != nil {
+					t.Errorf("posting %d without positions = %+v", i, p)
+				}
+			}
+		})
+	}
+
+	data := encodePostings([]Posting{{Doc: 1, Freq: 2, Positions: []uint32{1, 2}}})
+	if _, err := decodePostings(data[:len(data)-1], true); err == nil {
+		t.Error("truncated list decoded without error")
+	}
+}
+
+func TestMergePostings(t *testing.T) {
+	p := func(doc, freq uint32) Posting { return Posting{Doc: doc, Freq: freq} }
+	tests := []struct {
+		name      string
+		list, add []Posting
+		want      []Posting
+	}{
+		{"into empty", nil, []Posting{p(2, 1), p(1, 1)}, []Posting{p(1, 1), p(2, 1)}},
+		{"nothing added", []Posting{p(1, 1)}, nil, []Posting{p(1, 1)}},
+		{"interleaved", []Posting{p(1, 1), p(5, 1)}, []Posting{p(3, 1), p(7, 1), p(0, 1)},
+			[]Posting{p(0, 1), p(1, 1), p(3, 1), p(5, 1), p(7, 1)}},
+		{"replaces re-added", []Posting{p(1, 1), p(2, 1), p(3, 1)}, []Posting{p(2, 9)},
+			[]Posting{p(1, 1), p(2, 9), p(3, 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergePostings(tt.list, tt.add)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testRecord(url, title, body string) *parser.ParsedRecord {
+	return &parser.ParsedRecord{
+		DocID:      "hltv-" + filepath.Base(url),
+		Source:     "hltv",
+		URL:        url,
+		Title:      title,
+		Paragraphs: []string{body},
+		RawHash:    title + "|" + body,
+	}
+}
+
+func openTestIndex(t *testing.T) *Index {
+	t.Helper()
+	ix, err := OpenIndex(filepath.Join(t.TempDir(), "index.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ix.Close() })
+	return ix
+}
+
+// indexState is what a test checks of an index: doc ids per posting key,
+// the forward list of every document and the summed field lengths
+type indexState struct {
+	postings map[string][]uint32
+	forward  map[uint32][]string
+	total    int64
+	docs     int
+}
+
+func readIndexState(t *testing.T, ix *Index) indexState {
+	t.Helper()
+	s := indexState{postings: make(map[string][]uint32), forward: make(map[uint32][]string)}
+	err := ix.View(func(r *IndexReader) error {
+		err := r.tx.Bucket(postingsBucket).ForEach(func(k, v []byte) error {
+			list, err := decodePostings(v, false)
+			for _, p := range list {
+				s.postings[string(k)] = append(s.postings[string(k)], p.Doc)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range r.AllDocs() {
+			if data := r.tx.Bucket(forwardBucket).Get(encodeID(id)); len(data) > 0 {
+				s.forward[id] = strings.Split(string(data), "\n")
+			}
+		}
+		s.total = r.TotalLength()
+		s.docs = r.NumDocs()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func key(field, word string) string {
+	return postingKey(field, Analyze(word)[0])
+}
+
+func TestIndexUpdate(t *testing.T) {
+	ix := openTestIndex(t)
+	a := testRecord("https://www.hltv.org/news/1/a", "navi major", "donk mvp")
+	b := testRecord("https://www.hltv.org/news/2/b", "vitality major", "zywoo")
+
+	res, err := ix.Update([]*parser.ParsedRecord{a, b}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (IndexUpdate{Added: 2}) {
+		t.Errorf("first update %+v, want 2 added", res)
+	}
+	s := readIndexState(t, ix)
+	if got := s.postings[key(FieldTitle, "major")]; !reflect.DeepEqual(got, []uint32{0, 1}) {
+		t.Errorf("title:major postings %v, want [0 1]", got)
+	}
+	// title 2 + body 2 + source 1, then title 2 + body 1 + source 1
+	if s.total != 9 {
+		t.Errorf("total length %d, want 9", s.total)
+	}
+
+	// Unchanged records are left alone
+	res, err = ix.Update([]*parser.ParsedRecord{a}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (IndexUpdate{Unchanged: 1}) {
+		t.Errorf("repeated update %+v, want 1 unchanged", res)
+	}
+
+	// A changed record keeps its id and loses the terms it no longer has
+	a2 := testRecord(a.URL, "navi champions", "donk")
+	res, err = ix.Update([]*parser.ParsedRecord{a2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (IndexUpdate{Updated: 1}) {
+		t.Errorf("changed update %+v, want 1 updated", res)
+	}
+	s = readIndexState(t, ix)
+	if got := s.postings[key(FieldTitle, "major")]; !reflect.DeepEqual(got, []uint32{1}) {
+		t.Errorf("title:major postings after update %v, want [1]", got)
+	}
+	if got := s.postings[key(FieldTitle, "champions")]; !reflect.DeepEqual(got, []uint32{0}) {
+		t.Errorf("title:champions postings %v, want [0]", got)
+	}
+	if _, ok := s.postings[key(FieldBody, "mvp")]; ok {
+		t.Error("body:mvp still has postings after its only document dropped it")
+	}
+	for _, k := range s.forward[0] {
+		if k == key(FieldBody, "mvp") || k == key(FieldTitle, "major") {
+			t.Errorf("forward list of doc 0 still holds %s", k)
+		}
+	}
+	if s.total != 8 {
+		t.Errorf("total length after update %d, want 8", s.total)
+	}
+
+	// Deleting removes the postings, forward list and lengths
+	res, err = ix.Update(nil, []string{b.URL, "https://www.hltv.org/news/3/unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (IndexUpdate{Deleted: 1}) {
+		t.Errorf("delete %+v, want 1 deleted", res)
+	}
+	s = readIndexState(t, ix)
+	if _, ok := s.postings[key(FieldTitle, "major")]; ok {
+		t.Error("title:major still has postings after its documents went")
+	}
+	if _, ok := s.forward[1]; ok {
+		t.Error("forward list of the deleted document kept")
+	}
+	if s.docs != 1 || s.total != 4 {
+		t.Errorf("after delete %d docs with total length %d, want 1 and 4", s.docs, s.total)
+	}
+	err = ix.View(func(r *IndexReader) error {
+		if doc, err := r.DocByKey(b.DocID); err != nil || doc != nil {
+			t.Errorf("doc key of the deleted document still resolves: %+v, %v", doc, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexSync(t *testing.T) {
+	store, err := parser.NewBoltStore(filepath.Join(t.TempDir(), "docs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	a := testRecord("https://www.hltv.org/news/1/a", "navi major", "donk")
+	b := testRecord("https://www.hltv.org/news/2/b", "vitality major", "zywoo")
+	if err := store.SaveParsed([]*parser.ParsedRecord{a, b}); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := openTestIndex(t)
+	res, err := ix.Sync(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (IndexUpdate{Added: 2}) {
+		t.Errorf("first sync %+v, want 2 added", res)
+	}
+
+	if err := store.DeleteParsed([]string{b.URL}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = ix.Sync(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (IndexUpdate{Unchanged: 1, Deleted: 1}) {
+		t.Errorf("second sync %+v, want 1 unchanged and 1 deleted", res)
+	}
+	err = ix.View(func(r *IndexReader) error {
+		if doc, _ := r.DocByURL(b.URL); doc != nil {
+			t.Error("stale URL still indexed")
+		}
+		if doc, _ := r.DocByURL(a.URL); doc == nil {
+			t.Error("remaining URL missing from the index")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"corpus_parser/parser"
+)
+
+// Indexer keeps the index at Path in step with the parsed articles the
+// crawler writes. It is a parser.ParsedListener; the index file is opened
+// only for the length of each update so search processes can read it in
+// between. A batch that fails to index is kept and merged into the next one.
+type Indexer struct {
+	Path     string
+	Entities *EntityMatcher
+
+	mu    sync.Mutex
+	total IndexUpdate
+	// pending holds the changes of failed batches, one per URL in the
+	// order first seen: a record to index, or nil for a removal
+	pending map[string]*parser.ParsedRecord
+	order   []string
+}
+
+func NewIndexer(path string, entities *EntityMatcher) *Indexer {
+	return &Indexer{Path: path, Entities: entities, pending: make(map[string]*parser.ParsedRecord)}
+}
+
+func (ix *Indexer) ParsedChanged(records []*parser.ParsedRecord, removed []string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, url := range removed {
+		ix.queue(url, nil)
+	}
+	for _, r := range records {
+		ix.queue(r.URL, r)
+	}
+	if len(ix.order) == 0 {
+		return
+	}
+
+	var update []*parser.ParsedRecord
+	var remove []string
+	for _, url := range ix.order {
+		if r := ix.pending[url]; r != nil {
+			update = append(update, r)
+		} else {
+			remove = append(remove, url)
+		}
+	}
+
+	index, err := OpenIndex(ix.Path, false)
+	if err != nil {
+		fmt.Printf("[index] %v; %d changes kept for the next batch\n", err, len(ix.order))
+		return
+	}
+	defer index.Close()
+	index.Entities = ix.Entities
+
+	res, err := index.Update(update, remove)
+	if err != nil {
+		fmt.Printf("[index] Failed to index %d articles, kept for the next batch: %v\n", len(update), err)
+		return
+	}
+	ix.pending = make(map[string]*parser.ParsedRecord)
+	ix.order = nil
+
+	ix.total.Added += res.Added
+	ix.total.Updated += res.Updated
+	ix.total.Deleted += res.Deleted
+	ix.total.Unchanged += res.Unchanged
+
+	if res.Added+res.Updated+res.Deleted > 0 {
+		fmt.Printf("[index] +%d added, %d updated, %d deleted\n", res.Added, res.Updated, res.Deleted)
+	}
+}
+
+// queue records the latest change of url; callers must hold ix.mu
+func (ix *Indexer) queue(url string, r *parser.ParsedRecord) {
+	if _, ok := ix.pending[url]; !ok {
+		ix.order = append(ix.order, url)
+	}
+	ix.pending[url] = r
+}
+
+// Pending returns how many changes failed to index and wait for the next
+// batch. They are lost on exit; "index" catches the index up with the store.
+func (ix *Indexer) Pending() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return len(ix.order)
+}
+
+// Totals returns what the indexer did so far
+func (ix *Indexer) Totals() IndexUpdate {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.total
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"corpus_parser/parser"
+)
+
+// Changes that fail to index wait for the next batch, the latest change of
+// each URL winning
+func TestIndexerRetriesFailedBatches(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "index")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndexer(filepath.Join(dir, "index.db"), nil)
+
+	a := testRecord("https://www.hltv.org/news/1/a", "navi major", "donk")
+	b := testRecord("https://www.hltv.org/news/2/b", "vitality major", "zywoo")
+	c := testRecord("https://www.hltv.org/news/3/c", "faze cologne", "ropz")
+	ix.ParsedChanged([]*parser.ParsedRecord{b}, nil)
+	if ix.Pending() != 0 {
+		t.Fatalf("%d changes pending after a working update", ix.Pending())
+	}
+
+	// A file in place of the index directory makes every open fail
+	if err := os.Rename(dir, dir+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix.ParsedChanged([]*parser.ParsedRecord{a, c}, []string{b.URL})
+	ix.ParsedChanged(nil, []string{c.URL})
+	ix.ParsedChanged([]*parser.ParsedRecord{b}, nil)
+	if ix.Pending() != 3 {
+		t.Errorf("%d changes pending, want one for each of a, b and c", ix.Pending())
+	}
+
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(dir+".moved", dir); err != nil {
+		t.Fatal(err)
+	}
+	ix.ParsedChanged(nil, nil)
+	if ix.Pending() != 0 {
+		t.Errorf("%d changes still pending after the index came back", ix.Pending())
+	}
+
+	index, err := OpenIndex(ix.Path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	err = index.View(func(r *IndexReader) error {
+		for _, tt := range []struct {
+			url     string
+			indexed bool
+		}{{a.URL, true}, {b.URL, true}, {c.URL, false}} {
+			doc, err := r.DocByURL(tt.url)
+			if err != nil {
+				return err
+			}
+			if (doc != nil) != tt.indexed {
+				t.Errorf("%s indexed = %v, want %v", tt.url, doc != nil, tt.indexed)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := ix.Totals(); total.Added != 2 || total.Deleted != 0 {
+		t.Errorf("totals %+v, want 2 added and none deleted", total)
+	}
+}
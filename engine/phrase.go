@@ -0,0 +1,278 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Clause kinds of a ranked query
+const (
+	ClauseTerm = iota
+	ClausePhrase
+	ClauseNear
+)
+
+// DefaultNearDistance is used for a bare NEAR without /n
+const DefaultNearDistance = 10
+
+// Clause is one unit of a ranked query: a single term, an exact phrase, or
+// two terms that must occur within Distance tokens of each other. Field
+// limits the clause to one field; empty means all of them.
+type Clause struct {
+	Kind     int
+	Field    string
+	Terms    []string
+	Distance int
+}
+
+func (c Clause) String() string {
+	var s string
+	switch c.Kind {
+	case ClausePhrase:
+		s = `"` + strings.Join(c.Terms, " ") + `"`
+	case ClauseNear:
+		s = fmt.Sprintf("%s NEAR/%d %s", c.Terms[0], c.Distance, c.Terms[1])
+	default:
+		s = c.Terms[0]
+	}
+	if c.Field != "" {
+		if c.Kind == ClauseNear {
+			s = "(" + s + ")"
+		}
+		s = c.Field + ":" + s
+	}
+	return s
+}
+
+// Positional reports whether the clause has to be verified against positions
+func (c Clause) Positional() bool {
+	return c.Kind != ClauseTerm
+}
+
+// Required reports whether a document has to match the clause. Phrase,
+// NEAR and fielded clauses are; plain terms only add to the score.
+func (c Clause) Required() bool {
+	return c.Kind != ClauseTerm || c.Field != ""
+}
+
+// QueryError is a mistake in the query itself, as opposed to a failure to
+// run it
+type QueryError struct {
+	Err error
+}
+
+func (e *QueryError) Error() string { return e.Err.Error() }
+func (e *QueryError) Unwrap() error { return e.Err }
+
+var nearOperator = regexp.MustCompile(`^NEAR(?:/(\d+))?$`)
+
+var fieldPrefix = regexp.MustCompile(`^([a-z]+):(.*)$`)
+
+type queryItem struct {
+	field  string
+	text   string
+	quoted bool
+}
+
+// ParseSearchQuery splits a ranked query into clauses. "quoted text" is a
+// phrase, and so is an unquoted word the analyzer splits into several terms
+// (na'vi). a NEAR/n b matches a and b at most n tokens apart in either order;
+// NEAR must be upper case so the word "near" stays searchable. Chains like
+// a NEAR/3 b NEAR/3 c become one clause per pair. field:term and
+// field:"a phrase" search a single field.
+func ParseSearchQuery(query string) ([]Clause, error) {
+	items, err := splitQueryItems(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var clauses []Clause
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		m := nearOperator.FindStringSubmatch(item.text)
+		if item.quoted || m == nil {
+			terms := Analyze(item.text)
+			switch {
+			case len(terms) == 0:
+			case len(terms) == 1:
+				clauses = append(clauses, Clause{Kind: ClauseTerm, Field: item.field, Terms: terms})
+			default:
+				clauses = append(clauses, Clause{Kind: ClausePhrase, Field: item.field, Terms: terms})
+			}
+			continue
+		}
+
+		distance := DefaultNearDistance
+		if m[1] != "" {
+			distance, _ = strconv.Atoi(m[1])
+		}
+		if len(clauses) == 0 || clauses[len(clauses)-1].Kind == ClausePhrase || i+1 == len(items) {
+			return nil, fmt.Errorf("NEAR needs a single word on each side")
+		}
+		right := Analyze(items[i+1].text)
+		if len(right) != 1 {
+			return nil, fmt.Errorf("NEAR needs a single word on each side")
+		}
+		last := &clauses[len(clauses)-1]
+		field := last.Field
+		if f := items[i+1].field; f != "" {
+			if field != "" && field != f {
+				return nil, fmt.Errorf("NEAR operands must be in the same field")
+			}
+			field = f
+		}
+		i++
+
+		left := last.Terms[len(last.Terms)-1]
+		near := Clause{Kind: ClauseNear, Field: field, Terms: []string{left, right[0]}, Distance: distance}
+		if last.Kind == ClauseTerm {
+			*last = near
+		} else {
+			clauses = append(clauses, near)
+		}
+	}
+	return clauses, nil
+}
+
+func splitQueryItems(query string) ([]queryItem, error) {
+	var items []queryItem
+	var cur strings.Builder
+	quoted := false
+	field := ""
+	flush := func() {
+		if cur.Len() > 0 || quoted {
+			item := queryItem{field: field, text: cur.String(), quoted: quoted}
+			if m := fieldPrefix.FindStringSubmatch(item.text); !quoted && m != nil && IsField(m[1]) {
+				item.field, item.text = m[1], m[2]
+			}
+			items = append(items, item)
+			cur.Reset()
+		}
+		field = ""
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			// field:"phrase" keeps the field of the text before the quote
+			prefix := ""
+			if m := fieldPrefix.FindStringSubmatch(cur.String()); !quoted && m != nil && m[2] == "" && IsField(m[1]) {
+				prefix = m[1]
+				cur.Reset()
+			}
+			flush()
+			field = prefix
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated phrase")
+	}
+	flush()
+	return items, nil
+}
+
+// ClauseMatches returns, for every document satisfying a phrase or NEAR
+// clause within field, how many times it does. Candidates come from a linear
+// merge of the posting lists; each one is then verified against positions.
+func (r *IndexReader) ClauseMatches(c Clause, field string) (map[uint32]uint32, error) {
+	lists := make([][]Posting, len(c.Terms))
+	for i, term := range c.Terms {
+		list, err := r.FieldPostings(field, term, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, nil
+		}
+		lists[i] = list
+	}
+
+	matches := make(map[uint32]uint32)
+	cursors := make([]int, len(lists))
+	for _, p := range lists[0] {
+		postings := []Posting{p}
+		found := true
+		for i := 1; i < len(lists); i++ {
+			list := lists[i]
+			for cursors[i] < len(list) && list[cursors[i]].Doc < p.Doc {
+				cursors[i]++
+			}
+			if cursors[i] == len(list) {
+				return matches, nil
+			}
+			if list[cursors[i]].Doc != p.Doc {
+				found = false
+				break
+			}
+			postings = append(postings, list[cursors[i]])
+		}
+		if !found {
+			continue
+		}
+
+		var n uint32
+		if c.Kind == ClauseNear {
+			n = nearCount(postings[0].Positions, postings[1].Positions, c.Distance)
+		} else {
+			n = phraseCount(postings)
+		}
+		if n > 0 {
+			matches[p.Doc] = n
+		}
+	}
+	return matches, nil
+}
+
+// phraseCount counts the positions where term k of the phrase sits at
+// offset k from the first term, by intersecting the shifted position lists
+func phraseCount(postings []Posting) uint32 {
+	starts := postings[0].Positions
+	for k := 1; k < len(postings) && len(starts) > 0; k++ {
+		next := postings[k].Positions
+		var kept []uint32
+		i, j := 0, 0
+		for i < len(starts) && j < len(next) {
+			want := starts[i] + uint32(k)
+			switch {
+			case next[j] < want:
+				j++
+			case next[j] > want:
+				i++
+			default:
+				kept = append(kept, starts[i])
+				i++
+				j++
+			}
+		}
+		starts = kept
+	}
+	return uint32(len(starts))
+}
+
+// nearCount counts the positions of a that have some b at most distance
+// tokens away, before or after
+func nearCount(a, b []uint32, distance int) uint32 {
+	var n uint32
+	j := 0
+	d := uint32(distance)
+	for _, pa := range a {
+		for j < len(b) && b[j]+d < pa {
+			j++
+		}
+		for k := j; k < len(b) && b[k] <= pa+d; k++ {
+			if b[k] != pa {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
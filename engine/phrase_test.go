@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"corpus_parser/parser"
+)
+
+func TestPhraseCount(t *testing.T) {
+	pos := func(p ...uint32) Posting { return Posting{Positions: p} }
+	tests := []struct {
+		name     string
+		postings []Posting
+		want     uint32
+	}{
+		{"adjacent", []Posting{pos(0, 5), pos(1, 7)}, 1},
+		{"every occurrence", []Posting{pos(0, 5), pos(1, 6)}, 2},
+		{"reversed", []Posting{pos(1), pos(0)}, 0},
+		{"one position gap", []Posting{pos(2), pos(4)}, 0},
+		{"three terms", []Posting{pos(0, 10), pos(1, 11), pos(2, 13)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := phraseCount(tt.postings); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNearCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     []uint32
+		distance int
+		want     uint32
+	}{
+		{"exactly n after", []uint32{0}, []uint32{3}, 3, 1},
+		{"n+1 after", []uint32{0}, []uint32{4}, 3, 0},
+		{"exactly n before", []uint32{4}, []uint32{1}, 3, 1},
+		{"n+1 before", []uint32{4}, []uint32{0}, 3, 0},
+		{"counts positions of a", []uint32{2, 5, 30}, []uint32{3}, 3, 2},
+		// The same term on both sides needs two occurrences
+		{"same term twice", []uint32{0, 3}, []uint32{0, 3}, 3, 2},
+		{"same term once", []uint32{0}, []uint32{0}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nearCount(tt.a, tt.b, tt.distance); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClauseMatches(t *testing.T) {
+	ix := openTestIndex(t)
+	boundary := testRecord("https://www.hltv.org/news/3/c", "report", "vitality won navi")
+	boundary.Paragraphs = append(boundary.Paragraphs, "major final")
+	records := []*parser.ParsedRecord{
+		testRecord("https://www.hltv.org/news/1/a", "report", "navi beat faze major final"),
+		testRecord("https://www.hltv.org/news/2/b", "report", "faze beat navi"),
+		boundary,
+		testRecord("https://www.hltv.org/news/4/d", "report", "s1mple donk zywoo ropz"),
+		testRecord("https://www.hltv.org/news/5/e", "report", "s1mple donk zywoo monesy ropz"),
+		testRecord("https://www.hltv.org/news/6/f", "report", "navi donk zywoo navi"),
+	}
+	if _, err := ix.Update(records, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  map[uint32]uint32
+	}{
+		{`"navi beat"`, map[uint32]uint32{0: 1}},
+		{`"beat navi"`, map[uint32]uint32{1: 1}},
+		{`"won navi"`, map[uint32]uint32{2: 1}},
+		// The paragraphs of doc 2 end and start with these words
+		{`"navi major"`, map[uint32]uint32{}},
+		{`"major final"`, map[uint32]uint32{0: 1, 2: 1}},
+		{"s1mple NEAR/3 ropz", map[uint32]uint32{3: 1}},
+		{"ropz NEAR/3 s1mple", map[uint32]uint32{3: 1}},
+		{"s1mple NEAR/4 ropz", map[uint32]uint32{3: 1, 4: 1}},
+		{"s1mple NEAR/2 ropz", map[uint32]uint32{}},
+		{"navi NEAR/3 navi", map[uint32]uint32{5: 2}},
+		{"navi NEAR/2 navi", map[uint32]uint32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			clauses, err := ParseSearchQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(clauses) != 1 || !clauses[0].Positional() {
+				t.Fatalf("parsed as %v, want one positional clause", clauses)
+			}
+			var got map[uint32]uint32
+			err = ix.View(func(r *IndexReader) error {
+				got, err = r.ClauseMatches(clauses[0], FieldBody)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				got = map[uint32]uint32{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
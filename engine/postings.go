@@ -0,0 +1,74 @@
+// Package engine answers queries over the corpus: boolean queries over the
+// BOOLEAN_INDEX files the C++ tools build
+package engine
+
+// Postings is a sorted list of doc ids without duplicates
+type Postings []uint32
+
+// Intersect returns the ids present in both lists
+func Intersect(a, b Postings) Postings {
+	var out Postings
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Union returns the ids present in either list
+func Union(a, b Postings) Postings {
+	out := make(Postings, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// Difference returns the ids of a that are not in b
+func Difference(a, b Postings) Postings {
+	var out Postings
+	i, j := 0, 0
+	for i < len(a) {
+		if j >= len(b) || a[i] < b[j] {
+			out = append(out, a[i])
+			i++
+		} else if a[i] > b[j] {
+			j++
+		} else {
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// All returns every id below n
+func All(n int) Postings {
+	out := make(Postings, n)
+	for i := range out {
+		out[i] = uint32(i)
+	}
+	return out
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query is a parsed boolean query
+type Query interface {
+	String() string
+}
+
+type TermQuery struct {
+	Term string
+}
+
+type AndQuery struct {
+	Clauses []Query
+}
+
+type OrQuery struct {
+	Clauses []Query
+}
+
+type NotQuery struct {
+	Clause Query
+}
+
+func (q *TermQuery) String() string { return q.Term }
+func (q *NotQuery) String() string  { return "NOT " + q.Clause.String() }
+func (q *AndQuery) String() string  { return joinQueries(q.Clauses, " AND ") }
+func (q *OrQuery) String() string   { return joinQueries(q.Clauses, " OR ") }
+
+func joinQueries(clauses []Query, sep string) string {
+	parts := make([]string, len(clauses))
+	for i, c := range clauses {
+		parts[i] = c.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// ParseQuery parses the query language of the C++ searcher: terms, and/or/not
+// (case-insensitive), -term for negation and parentheses. Adjacent terms are
+// ANDed; NOT binds tighter than AND, AND tighter than OR. normalize is applied
+// to every term.
+func ParseQuery(input string, normalize func(string) string) (Query, error) {
+	p := &queryParser{tokens: tokenizeQuery(input), normalize: normalize}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return q, nil
+}
+
+func tokenizeQuery(input string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range input {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '-' && cur.Len() == 0:
+			tokens = append(tokens, "-")
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type queryParser struct {
+	tokens    []string
+	pos       int
+	normalize func(string) string
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []Query{first}
+	for strings.EqualFold(p.peek(), "or") {
+		p.pos++
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, next)
+	}
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return &OrQuery{Clauses: clauses}, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []Query{first}
+	for {
+		tok := p.peek()
+		if tok == "" || tok == ")" || strings.EqualFold(tok, "or") {
+			break
+		}
+		if strings.EqualFold(tok, "and") {
+			p.pos++
+		}
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, next)
+	}
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return &AndQuery{Clauses: clauses}, nil
+}
+
+func (p *queryParser) parseUnary() (Query, error) {
+	tok := p.peek()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of query")
+	case tok == "-" || strings.EqualFold(tok, "not"):
+		p.pos++
+		clause, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotQuery{Clause: clause}, nil
+	case tok == "(":
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return q, nil
+	case tok == ")" || strings.EqualFold(tok, "and") || strings.EqualFold(tok, "or"):
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	p.pos++
+	return &TermQuery{Term: p.normalize(tok)}, nil
+}
+
+// PostingSource is an index that can serve posting lists
+type PostingSource interface {
+	Postings(term string) Postings
+	// AllDocs returns every doc id, the universe NOT is taken against
+	AllDocs() Postings
+}
+
+// Evaluate runs a boolean query against an index. Negations inside an AND
+// are applied as differences, so only a query that is negative as a whole
+// touches the full doc id range.
+func Evaluate(idx PostingSource, q Query) Postings {
+	switch q := q.(type) {
+	case *TermQuery:
+		return idx.Postings(q.Term)
+	case *NotQuery:
+		return Difference(idx.AllDocs(), Evaluate(idx, q.Clause))
+	case *OrQuery:
+		var out Postings
+		for _, c := range q.Clauses {
+			out = Union(out, Evaluate(idx, c))
+		}
+		return out
+	case *AndQuery:
+		var positive []Postings
+		var negative []Query
+		for _, c := range q.Clauses {
+			if not, ok := c.(*NotQuery); ok {
+				negative = append(negative, not.Clause)
+			} else {
+				positive = append(positive, Evaluate(idx, c))
+			}
+		}
+
+		var out Postings
+		if len(positive) == 0 {
+			out = idx.AllDocs()
+		} else {
+			// Intersect shortest lists first to keep intermediates small
+			sortBySize(positive)
+			out = positive[0]
+			for _, list := range positive[1:] {
+				if len(out) == 0 {
+					break
+				}
+				out = Intersect(out, list)
+			}
+		}
+		for _, c := range negative {
+			if len(out) == 0 {
+				break
+			}
+			out = Difference(out, Evaluate(idx, c))
+		}
+		return out
+	}
+	return nil
+}
+
+func sortBySize(lists []Postings) {
+	for i := 1; i < len(lists); i++ {
+		for j := i; j > 0 && len(lists[j]) < len(lists[j-1]); j-- {
+			lists[j], lists[j-1] = lists[j-1], lists[j]
+		}
+	}
+}
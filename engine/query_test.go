@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   bool
+	}{
+		{query: "navi", want: "navi"},
+		{query: "NaVi Major", want: "(navi AND major)"},
+		{query: "navi and major", want: "(navi AND major)"},
+		{query: "navi OR vitality major", want: "(navi OR (vitality AND major))"},
+		{query: "navi -major", want: "(navi AND NOT major)"},
+		{query: "not (navi or faze) major", want: "(NOT (navi OR faze) AND major)"},
+		{query: "(navi)", want: "navi"},
+		{query: "", err: true},
+		{query: "navi and", err: true},
+		{query: "or navi", err: true},
+		{query: "(navi major", err: true},
+		{query: "navi)", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query, strings.ToLower)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parsed as %s, want an error", q)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.String() != tt.want {
+				t.Errorf("got %s, want %s", q, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+		err   bool
+	}{
+		{query: "navi", want: []string{"navi"}},
+		{query: `"navi major"`, want: []string{`"navi major"`}},
+		{query: "navi NEAR/3 major", want: []string{"navi NEAR/3 major"}},
+		{query: "navi NEAR major", want: []string{"navi NEAR/10 major"}},
+		{query: "navi near major", want: []string{"navi", "near", "major"}},
+		{query: "a1 NEAR/2 b1 NEAR/2 c1", want: []string{"a1 NEAR/2 b1", "b1 NEAR/2 c1"}},
+		{query: "title:navi donk", want: []string{"title:navi", "donk"}},
+		{query: `title:"navi major"`, want: []string{`title:"navi major"`}},
+		{query: "title:navi NEAR/2 major", want: []string{"title:(navi NEAR/2 major)"}},
+		{query: "unknown:navi", want: []string{`"unknown navi"`}},
+		{query: `"navi major`, err: true},
+		{query: "NEAR/2 major", err: true},
+		{query: "navi NEAR/2", err: true},
+		{query: `"navi major" NEAR/2 donk`, err: true},
+		{query: "title:navi NEAR/2 body:major", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			clauses, err := ParseSearchQuery(tt.query)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parsed as %v, want an error", clauses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(clauses))
+			for i, c := range clauses {
+				got[i] = c.String()
+			}
+			// Compare analyzed forms, the stemmer may shorten the words
+			want := make([]string, len(tt.want))
+			for i, w := range tt.want {
+				want[i] = analyzedClause(w)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// analyzedClause runs the words of a clause string through the analyzer,
+// leaving quotes, fields and operators as they are
+func analyzedClause(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		prefix, core, suffix := "", w, ""
+		if j := strings.Index(core, ":"); j >= 0 {
+			prefix, core = core[:j+1], core[j+1:]
+		}
+		for len(core) > 0 && strings.ContainsRune(`"(`, rune(core[0])) {
+			prefix, core = prefix+core[:1], core[1:]
+		}
+		for len(core) > 0 && strings.ContainsRune(`")`, rune(core[len(core)-1])) {
+			core, suffix = core[:len(core)-1], core[len(core)-1:]+suffix
+		}
+		if strings.HasPrefix(core, "NEAR") || core == "" {
+			continue
+		}
+		if terms := Analyze(core); len(terms) == 1 {
+			words[i] = prefix + terms[0] + suffix
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func TestParseFacetFilters(t *testing.T) {
+	tests := []struct {
+		query   string
+		text    string
+		filters FacetFilter
+		err     bool
+	}{
+		{query: "navi major", text: "navi major", filters: FacetFilter{}},
+		{query: "navi @source:hltv", text: "navi", filters: FacetFilter{"source": {"hltv"}}},
+		{query: `@tag:"Natus Vincere" major`, text: "major", filters: FacetFilter{"tag": {"natus vincere"}}},
+		{query: "@year:2024 @month:2024-07 @year:2024", text: "",
+			filters: FacetFilter{"year": {"2024"}, "month": {"2024-07"}}},
+		{query: "@entity:s1mple @entity:donk", text: "", filters: FacetFilter{"entity": {"s1mple", "donk"}}},
+		{query: "mail@source:hltv", text: "mail@source:hltv", filters: FacetFilter{}},
+		{query: "@team:navi", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			text, filters, err := ParseFacetFilters(tt.query)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parsed as %q %v, want an error", text, filters)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.text {
+				t.Errorf("text %q, want %q", text, tt.text)
+			}
+			if !reflect.DeepEqual(filters, tt.filters) {
+				t.Errorf("filters %v, want %v", filters, tt.filters)
+			}
+		})
+	}
+}
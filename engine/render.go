@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"fmt"
+
+	"corpus_parser/parser"
+)
+
+// HitView is a ranked hit ready for output, with the title and snippet
+// rendered in one output style
+type HitView struct {
+	Rank int `json:"rank"`
+	// DocID is the persistent id from the manifest, -1 if it has none.
+	// Articles saved before ids were assigned on save have none until the
+	// next indexed export.
+	DocID  int    `json:"doc_id"`
+	DocKey string `json:"doc_key"`
+	// Ref is how to refer to the document: the doc id, or the doc key
+	// without one
+	Ref       string      `json:"ref"`
+	Score     float64     `json:"score"`
+	Source    string      `json:"source"`
+	URL       string      `json:"url"`
+	Title     string      `json:"title"`
+	Published string      `json:"published,omitempty"`
+	Marked    string      `json:"title_marked"`
+	Snippet   string      `json:"snippet"`
+	Passages  []Passage   `json:"passages"`
+	Terms     []TermScore `json:"terms"`
+}
+
+// DocRef returns the doc id when the manifest has one, otherwise the doc key
+func DocRef(id int, key string) string {
+	if id >= 0 {
+		return fmt.Sprint(id)
+	}
+	return key
+}
+
+// MarkersFor returns the highlight markers of a style, taking configured
+// ones over the defaults
+func MarkersFor(style string, configured map[string]parser.MarkerConfig) (Markers, error) {
+	m, ok := DefaultMarkers[style]
+	if !ok {
+		return m, fmt.Errorf("unknown output style %q (terminal, html or json)", style)
+	}
+	if c, ok := configured[style]; ok {
+		m = Markers{Pre: c.Pre, Post: c.Post}
+	}
+	return m, nil
+}
+
+// ViewHits renders the hits of a result page. Titles come from the index;
+// only the doc id is looked up in the manifest.
+func ViewHits(res *SearchResult, offset int, manifest *parser.Manifest, m Markers, style string) []HitView {
+	views := make([]HitView, 0, len(res.Hits))
+	for i, hit := range res.Hits {
+		v := HitView{
+			Rank:      offset + i + 1,
+			DocID:     -1,
+			DocKey:    hit.Doc.DocKey,
+			Score:     hit.Score,
+			Source:    hit.Doc.Source,
+			URL:       hit.Doc.URL,
+			Title:     hit.Doc.Title,
+			Published: hit.Doc.Published,
+			Marked:    hit.Title.Mark(m, style),
+			Snippet:   MarkPassages(hit.Snippet, m, style),
+			Passages:  hit.Snippet,
+			Terms:     hit.Terms,
+		}
+		if manifest != nil {
+			if entry := manifest.ByURL(hit.Doc.URL); entry != nil {
+				v.DocID = entry.ID
+			}
+		}
+		v.Ref = DocRef(v.DocID, v.DocKey)
+		if v.Passages == nil {
+			v.Passages = []Passage{}
+		}
+		views = append(views, v)
+	}
+	return views
+}
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"corpus_parser/parser"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 50
+	// maxPage keeps the offset of deep pages far from overflowing
+	maxPage = 10000
+)
+
+// Server answers search requests over HTTP with JSON and serves a small
+// page for trying queries by hand:
+//
+//	GET /search?q=&source=&from=&to=&page=&size=&facets=
+//	GET /doc/{id}   manifest doc id or doc key
+//	GET /
+//
+// The index is opened read-only for each request and the manifest is read
+// again when it changed, so a live crawler can keep updating both in between.
+type Server struct {
+	IndexPath    string
+	ManifestPath string
+	// Options carries the ranking and snippet settings; paging and filters
+	// come from the request
+	Options SearchOptions
+	Markers Markers
+
+	mux *http.ServeMux
+
+	manifestMu       sync.Mutex
+	manifest         *parser.Manifest
+	manifestModified time.Time
+}
+
+// SearchResponse is the JSON body of /search
+type SearchResponse struct {
+	Query  []string      `json:"query"`
+	Total  int           `json:"total"`
+	Page   int           `json:"page"`
+	Size   int           `json:"size"`
+	Pages  int           `json:"pages"`
+	TookMs float64       `json:"took_ms"`
+	Hits   []HitView     `json:"hits"`
+	Facets []FacetResult `json:"facets,omitempty"`
+}
+
+// DocView is the JSON body of /doc/{id}
+type DocView struct {
+	DocID      int      `json:"doc_id"`
+	DocKey     string   `json:"doc_key"`
+	Ref        string   `json:"ref"`
+	Source     string   `json:"source"`
+	URL        string   `json:"url"`
+	Title      string   `json:"title"`
+	Published  string   `json:"published,omitempty"`
+	Lead       string   `json:"lead,omitempty"`
+	Paragraphs []string `json:"paragraphs"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// NewServer serves the index at indexPath; manifestPath may be empty when
+// there is no manifest
+func NewServer(indexPath, manifestPath string, opts SearchOptions, m Markers) *Server {
+	s := &Server{IndexPath: indexPath, ManifestPath: manifestPath, Options: opts, Markers: m}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/doc/", s.handleDoc)
+	s.mux.HandleFunc("/", s.handleUI)
+	return s
+}
+
+// currentManifest returns the manifest, read again when the file changed
+// since the last request. A manifest that fails to load keeps the previous
+// one.
+func (s *Server) currentManifest() *parser.Manifest {
+	if s.ManifestPath == "" {
+		return nil
+	}
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	info, err := os.Stat(s.ManifestPath)
+	if err != nil || info.ModTime().Equal(s.manifestModified) {
+		return s.manifest
+	}
+	manifest, err := parser.LoadManifest(s.ManifestPath)
+	if err != nil {
+		fmt.Printf("[serve] Failed to reload manifest: %v\n", err)
+		return s.manifest
+	}
+	s.manifest = manifest
+	s.manifestModified = info.ModTime()
+	return s.manifest
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.mux.ServeHTTP(rec, r)
+	fmt.Printf("[serve] %s %s %d %s\n", r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Microsecond))
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+
+	page, err := intParam(q.Get("page"), 1)
+	if err != nil || page < 1 || page > maxPage {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("page must be between 1 and %d", maxPage))
+		return
+	}
+	size, err := intParam(q.Get("size"), defaultPageSize)
+	if err != nil || size < 1 || size > maxPageSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("size must be between 1 and %d", maxPageSize))
+		return
+	}
+
+	opts := s.Options
+	opts.Offset = (page - 1) * size
+	opts.Limit = size
+	opts.Source = strings.TrimSpace(q.Get("source"))
+	// Every facet is counted unless the request names some, or none with
+	// facets=
+	opts.Facets = AllFacets
+	if list, ok := q["facets"]; ok {
+		if opts.Facets, err = ParseFacetNames(strings.Join(list, ",")); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	for _, d := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &opts.From}, {"to", &opts.To}} {
+		value := q.Get(d.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, d.name+" must be YYYY-MM-DD")
+			return
+		}
+		*d.dst = t
+	}
+	// to names the last day included
+	if !opts.To.IsZero() {
+		opts.To = opts.To.AddDate(0, 0, 1)
+	}
+
+	index, err := OpenIndex(s.IndexPath, true)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer index.Close()
+
+	start := time.Now()
+	res, err := index.Search(query, opts)
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SearchResponse{
+		Query:  res.Query,
+		Total:  res.Total,
+		Page:   page,
+		Size:   size,
+		Pages:  (res.Total + size - 1) / size,
+		TookMs: math.Round(float64(time.Since(start).Microseconds())) / 1000,
+		Hits:   ViewHits(res, opts.Offset, s.currentManifest(), s.Markers, StyleHTML),
+		Facets: res.Facets,
+	})
+}
+
+// handleDoc looks a document up by its manifest doc id, or by doc key when
+// the id is not a number
+func (s *Server) handleDoc(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/doc/"), "/")
+	if key == "" {
+		writeError(w, http.StatusNotFound, "missing doc id")
+		return
+	}
+
+	index, err := OpenIndex(s.IndexPath, true)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer index.Close()
+
+	manifest := s.currentManifest()
+	var doc *IndexedDoc
+	var unknownID bool
+	err = index.View(func(ix *IndexReader) error {
+		var err error
+		if id, convErr := strconv.Atoi(key); convErr == nil {
+			var entry *parser.ManifestEntry
+			if manifest != nil {
+				entry = manifest.Lookup(id)
+			}
+			if entry == nil {
+				unknownID = true
+				return nil
+			}
+			doc, err = ix.DocByURL(entry.URL)
+			return err
+		}
+		doc, err = ix.DocByKey(key)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if unknownID {
+		writeError(w, http.StatusNotFound, "doc id "+key+" is not in the manifest; use the doc_key of documents without an id")
+		return
+	}
+	if doc == nil {
+		writeError(w, http.StatusNotFound, "no indexed document "+key)
+		return
+	}
+
+	view := DocView{
+		DocID:      -1,
+		DocKey:     doc.DocKey,
+		Source:     doc.Source,
+		URL:        doc.URL,
+		Title:      doc.Title,
+		Published:  doc.Published,
+		Lead:       doc.Lead,
+		Paragraphs: doc.Paragraphs,
+		Tags:       doc.Tags,
+	}
+	if manifest != nil {
+		if entry := manifest.ByURL(doc.URL); entry != nil {
+			view.DocID = entry.ID
+		}
+	}
+	view.Ref = DocRef(view.DocID, view.DocKey)
+	if view.Paragraphs == nil {
+		view.Paragraphs = []string{}
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"corpus_parser/parser"
+)
+
+func TestServerSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	ix, err := OpenIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testRecord("https://www.hltv.org/news/1/a", "navi major", "donk")
+	a.Metadata.Published = "2024-07-14T15:00:00+03:00"
+	b := testRecord("https://www.hltv.org/news/2/b", "navi cologne", "s1mple")
+	b.Metadata.Published = "2024-07-20T10:00:00Z"
+	if _, err := ix.Update([]*parser.ParsedRecord{a, b}, nil); err != nil {
+		t.Fatal(err)
+	}
+	ix.Close()
+
+	srv := NewServer(path, "", SearchOptions{BM25: BM25{K1: 1.2, B: 0.75}}, DefaultMarkers[StyleHTML])
+	tests := []struct {
+		query  string
+		status int
+		total  int
+		hits   int
+	}{
+		{"q=navi", http.StatusOK, 2, 2},
+		{"q=navi&to=2024-07-14", http.StatusOK, 1, 1},
+		{"q=navi&from=2024-07-20&to=2024-07-20", http.StatusOK, 1, 1},
+		{"q=navi&page=2&size=5", http.StatusOK, 2, 0},
+		{"q=navi&page=10000&size=50", http.StatusOK, 2, 0},
+		{"q=navi&page=10001", http.StatusBadRequest, 0, 0},
+		{"q=navi&page=-1", http.StatusBadRequest, 0, 0},
+		{"q=%22navi", http.StatusBadRequest, 0, 0},
+		{"q=@team:navi", http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp SearchResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Total != tt.total || len(resp.Hits) != tt.hits {
+				t.Errorf("total %d with %d hits, want %d with %d", resp.Total, len(resp.Hits), tt.total, tt.hits)
+			}
+		})
+	}
+
+	// A broken field weight is the server's fault, not the query's
+	srv.Options.FieldWeights = map[string]float64{"nope": 1}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=navi", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d for a bad config, want 500", rec.Code)
+	}
+}
+
+// Documents are found by manifest id or doc key, and ids the manifest gains
+// while the server runs are picked up
+func TestServerDoc(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.db")
+	ix, err := OpenIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testRecord("https://www.hltv.org/news/1/a", "navi major", "donk")
+	b := testRecord("https://www.hltv.org/news/2/b", "navi cologne", "s1mple")
+	if _, err := ix.Update([]*parser.ParsedRecord{a, b}, nil); err != nil {
+		t.Fatal(err)
+	}
+	ix.Close()
+
+	manifestPath := filepath.Join(dir, "manifest.tsv")
+	manifest, err := parser.LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Record(a)
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(path, manifestPath, SearchOptions{BM25: BM25{K1: 1.2, B: 0.75}}, DefaultMarkers[StyleHTML])
+
+	get := func(ref string) (int, DocView) {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc/"+ref, nil))
+		var view DocView
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &view); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, view
+	}
+	tests := []struct {
+		ref    string
+		status int
+		url    string
+		want   string
+	}{
+		{"0", http.StatusOK, a.URL, "0"},
+		{a.DocID, http.StatusOK, a.URL, "0"},
+		{b.DocID, http.StatusOK, b.URL, b.DocID},
+		{"1", http.StatusNotFound, "", ""},
+		{"hltv-c", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		status, view := get(tt.ref)
+		if status != tt.status || view.URL != tt.url || view.Ref != tt.want {
+			t.Errorf("/doc/%s: %d %s ref %q, want %d %s ref %q", tt.ref, status, view.URL, view.Ref, tt.status, tt.url, tt.want)
+		}
+	}
+
+	manifest.Record(b)
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change shows on file systems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(manifestPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if status, view := get("1"); status != http.StatusOK || view.URL != b.URL || view.Ref != "1" {
+		t.Errorf("/doc/1 after the manifest changed: %d %s ref %q", status, view.URL, view.Ref)
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	ix := openTestIndex(t)
+	records := []*parser.ParsedRecord{
+		testRecord("https://www.hltv.org/news/1/a", "navi major", "donk"),
+		testRecord("https://www.hltv.org/news/2/b", "navi cologne", "s1mple"),
+		testRecord("https://www.hltv.org/news/3/c", "navi", "navi navi"),
+	}
+	if _, err := ix.Update(records, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset, limit int
+		hits          int
+	}{
+		{0, 2, 2},
+		{2, 2, 1},
+		{1, math.MaxInt, 2},
+		{math.MaxInt, 10, 0},
+		{math.MaxInt - 1, math.MaxInt, 0},
+	}
+	for _, tt := range tests {
+		res, err := ix.Search("navi", SearchOptions{BM25: BM25{K1: 1.2, B: 0.75}, Offset: tt.offset, Limit: tt.limit})
+		if err != nil {
+			t.Fatalf("offset %d limit %d: %v", tt.offset, tt.limit, err)
+		}
+		if res.Total != 3 || len(res.Hits) != tt.hits {
+			t.Errorf("offset %d limit %d: total %d with %d hits, want 3 with %d", tt.offset, tt.limit, res.Total, len(res.Hits), tt.hits)
+		}
+	}
+
+	_, err := ix.Search("navi", SearchOptions{Offset: -5})
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) {
+		t.Errorf("negative offset gave %v, want a QueryError", err)
+	}
+}
@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"html"
+	"strings"
+)
+
+// Output styles with their own highlight markers
+const (
+	StyleTerminal = "terminal"
+	StyleHTML     = "html"
+	StyleJSON     = "json"
+)
+
+// Markers wrap a highlighted term
+type Markers struct {
+	Pre  string
+	Post string
+}
+
+// DefaultMarkers are used for styles the config does not override
+var DefaultMarkers = map[string]Markers{
+	StyleTerminal: {Pre: "\x1b[1;33m", Post: "\x1b[0m"},
+	StyleHTML:     {Pre: "<mark>", Post: "</mark>"},
+	StyleJSON:     {Pre: "<em>", Post: "</em>"},
+}
+
+// SnippetOptions controls snippet generation: up to Passages passages of
+// about Window tokens each
+type SnippetOptions struct {
+	Passages int
+	Window   int
+}
+
+// DefaultSnippetOptions give two passages of 30 tokens
+var DefaultSnippetOptions = SnippetOptions{Passages: 2, Window: 30}
+
+// Span is a highlighted byte range of a passage
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Passage is one piece of a snippet. Leading and Trailing tell whether the
+// text was cut inside its paragraph, so an ellipsis belongs there.
+type Passage struct {
+	Text       string `json:"text"`
+	Highlights []Span `json:"highlights"`
+	Leading    bool   `json:"leading"`
+	Trailing   bool   `json:"trailing"`
+}
+
+// Mark renders the passage with markers around highlighted terms. HTML
+// output escapes the text in between.
+func (p Passage) Mark(m Markers, style string) string {
+	escape := func(s string) string { return s }
+	if style == StyleHTML {
+		escape = html.EscapeString
+	}
+
+	var b strings.Builder
+	if p.Leading {
+		b.WriteString("… ")
+	}
+	last := 0
+	for _, h := range p.Highlights {
+		b.WriteString(escape(p.Text[last:h.Start]))
+		b.WriteString(m.Pre)
+		b.WriteString(escape(p.Text[h.Start:h.End]))
+		b.WriteString(m.Post)
+		last = h.End
+	}
+	b.WriteString(escape(p.Text[last:]))
+	if p.Trailing {
+		b.WriteString(" …")
+	}
+	return b.String()
+}
+
+// MarkPassages renders a whole snippet, passages separated by spaces
+func MarkPassages(passages []Passage, m Markers, style string) string {
+	parts := make([]string, len(passages))
+	for i, p := range passages {
+		parts[i] = p.Mark(m, style)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Highlight marks every token of text whose analyzed form is a query term
+func Highlight(text string, terms map[string]bool) Passage {
+	p := Passage{Text: text}
+	for _, t := range Tokenize(text) {
+		if terms[t.Term] {
+			p.Highlights = append(p.Highlights, Span{Start: t.Start, End: t.End})
+		}
+	}
+	return p
+}
+
+type window struct {
+	para  int
+	start int
+	end   int
+	score float64
+}
+
+// MakeSnippet picks the best passages of paragraphs for the query terms.
+// Every window of opts.Window tokens is scored by term density and
+// proximity: distinct query terms count most, then the number of hits, then
+// how close hits are to each other. The best window and the best one not
+// overlapping it are returned in text order. Without any hit the snippet is
+// the start of the text.
+func MakeSnippet(paragraphs []string, terms map[string]bool, opts SnippetOptions) []Passage {
+	if opts.Passages <= 0 {
+		opts.Passages = DefaultSnippetOptions.Passages
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultSnippetOptions.Window
+	}
+
+	tokens := make([][]Token, len(paragraphs))
+	var windows []window
+	for pi, para := range paragraphs {
+		tokens[pi] = Tokenize(para)
+		toks := tokens[pi]
+		for start := 0; start < len(toks); start++ {
+			if !terms[toks[start].Term] {
+				continue
+			}
+			end := start + opts.Window
+			if end > len(toks) {
+				end = len(toks)
+			}
+			windows = append(windows, window{para: pi, start: start, end: end, score: scoreWindow(toks[start:end], terms)})
+		}
+	}
+
+	var picked []window
+	for len(picked) < opts.Passages {
+		best := -1
+		for i, w := range windows {
+			if overlapsAny(w, picked) {
+				continue
+			}
+			if best < 0 || w.score > windows[best].score {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		picked = append(picked, windows[best])
+	}
+
+	if len(picked) == 0 {
+		for pi, toks := range tokens {
+			if len(toks) > 0 {
+				end := opts.Window
+				if end > len(toks) {
+					end = len(toks)
+				}
+				picked = append(picked, window{para: pi, start: 0, end: end})
+				break
+			}
+		}
+	}
+
+	// Text order reads better than score order
+	for i := 1; i < len(picked); i++ {
+		for j := i; j > 0 && before(picked[j], picked[j-1]); j-- {
+			picked[j], picked[j-1] = picked[j-1], picked[j]
+		}
+	}
+
+	// The lead-in of a passage must not reach back into the one before it
+	passages := make([]Passage, 0, len(picked))
+	prevPara, prevEnd := -1, 0
+	for _, w := range picked {
+		start, end := passageRange(len(tokens[w.para]), w, opts.Window)
+		if w.para == prevPara && start < prevEnd {
+			start = prevEnd
+		}
+		passages = append(passages, makePassage(paragraphs[w.para], tokens[w.para], start, end, terms))
+		prevPara, prevEnd = w.para, end
+	}
+	return passages
+}
+
+func scoreWindow(toks []Token, terms map[string]bool) float64 {
+	distinct := make(map[string]bool)
+	hits := 0
+	proximity := 0.0
+	last := -1
+	for i, t := range toks {
+		if !terms[t.Term] {
+			continue
+		}
+		hits++
+		if last >= 0 && t.Term != toks[last].Term {
+			proximity += 1 / float64(i-last)
+		}
+		distinct[t.Term] = true
+		last = i
+	}
+	return 4*float64(len(distinct)) + float64(hits) + 2*proximity
+}
+
+func overlapsAny(w window, picked []window) bool {
+	for _, p := range picked {
+		if p.para == w.para && w.start < p.end && p.start < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+func before(a, b window) bool {
+	if a.para != b.para {
+		return a.para < b.para
+	}
+	return a.start < b.start
+}
+
+// passageRange returns the tokens a window is shown with, moved back a
+// little so the first hit has some context before it
+func passageRange(n int, w window, size int) (start, end int) {
+	// A lead-in of a quarter window, unless the paragraph ends before
+	// the window is full anyway
+	start = w.start - size/4
+	if start < 0 {
+		start = 0
+	}
+	end = start + size
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+// makePassage cuts the text of tokens start to end out of a paragraph
+func makePassage(para string, toks []Token, start, end int, terms map[string]bool) Passage {
+	from, to := 0, len(para)
+	if start > 0 {
+		from = toks[start].Start
+	}
+	if end < len(toks) {
+		to = toks[end-1].End
+	}
+
+	p := Passage{Text: para[from:to], Leading: start > 0, Trailing: end < len(toks)}
+	for _, t := range toks[start:end] {
+		if terms[t.Term] {
+			p.Highlights = append(p.Highlights, Span{Start: t.Start - from, End: t.End - from})
+		}
+	}
+	return p
+}
+
+// highlightTerms collects the terms of the clauses that can match the text
+// fields snippets are made of
+func highlightTerms(clauses []Clause) map[string]bool {
+	terms := make(map[string]bool)
+	for _, c := range clauses {
+		switch c.Field {
+		case "", FieldTitle, FieldLead, FieldBody:
+			for _, t := range c.Terms {
+				terms[t] = true
+			}
+		}
+	}
+	return terms
+}
@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMakeSnippetPassagesDoNotOverlap(t *testing.T) {
+	words := make([]string, 60)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	words[0], words[30] = "navi", "major"
+	terms := map[string]bool{"navi": true, "major": true}
+
+	passages := MakeSnippet([]string{strings.Join(words, " ")}, terms, SnippetOptions{Passages: 2, Window: 30})
+	if len(passages) != 2 {
+		t.Fatalf("got %d passages, want 2", len(passages))
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range passages {
+		for _, w := range strings.Fields(p.Text) {
+			if seen[w] {
+				t.Errorf("%s shown twice: %q / %q", w, passages[0].Text, passages[1].Text)
+			}
+			seen[w] = true
+		}
+	}
+	if !strings.HasPrefix(passages[1].Text, "major") {
+		t.Errorf("second passage %q should start where the first ends", passages[1].Text)
+	}
+}
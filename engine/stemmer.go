@@ -0,0 +1,138 @@
+package engine
+
+// Stem reduces a lowercased Russian word to its stem with the Snowball
+// Russian algorithm, the rule set stemmer/stemmer.cpp approximates. Words
+// without Cyrillic vowels, Latin team names included, come back unchanged.
+func Stem(word string) string {
+	w := []rune(word)
+	rv := regionAfterVowel(w, 0)
+	if rv >= len(w) {
+		return word
+	}
+	// Step 1
+	if n, ok := matchSuffix(w, rv, perfectiveGerund1, true); ok {
+		w = w[:len(w)-n]
+	} else if n, ok := matchSuffix(w, rv, perfectiveGerund2, false); ok {
+		w = w[:len(w)-n]
+	} else {
+		if n, ok := matchSuffix(w, rv, reflexive, false); ok {
+			w = w[:len(w)-n]
+		}
+		if n, ok := matchSuffix(w, rv, adjective, false); ok {
+			w = w[:len(w)-n]
+			if n, ok := matchSuffix(w, rv, participle1, true); ok {
+				w = w[:len(w)-n]
+			} else if n, ok := matchSuffix(w, rv, participle2, false); ok {
+				w = w[:len(w)-n]
+			}
+		} else if n, ok := matchSuffix(w, rv, verb1, true); ok {
+			w = w[:len(w)-n]
+		} else if n, ok := matchSuffix(w, rv, verb2, false); ok {
+			w = w[:len(w)-n]
+		} else if n, ok := matchSuffix(w, rv, noun, false); ok {
+			w = w[:len(w)-n]
+		}
+	}
+
+	// Step 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+
+	// Step 3, in R2: the region after the second vowel-consonant pair
+	r2 := regionAfterConsonant(w, regionAfterVowel(w, regionAfterConsonant(w, regionAfterVowel(w, 0))))
+	if n, ok := matchSuffix(w, r2, derivational, false); ok {
+		w = w[:len(w)-n]
+	}
+
+	// Step 4
+	if n, ok := matchSuffix(w, rv, superlative, false); ok {
+		w = w[:len(w)-n]
+	}
+	switch {
+	case hasSuffix(w, rv, "нн"):
+		w = w[:len(w)-1]
+	case hasSuffix(w, rv, "ь"):
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
+
+var (
+	perfectiveGerund1 = []string{"вшись", "вши", "в"}
+	perfectiveGerund2 = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+	reflexive         = []string{"ся", "сь"}
+	adjective         = []string{"ими", "ыми", "его", "ого", "ему", "ому", "ее", "ие", "ые", "ое", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	participle1       = []string{"ем", "нн", "вш", "ющ", "щ"}
+	participle2       = []string{"ивш", "ывш", "ующ"}
+	verb1             = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны", "ть", "й", "л", "н"}
+	verb2             = []string{"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено", "ует", "уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ят", "ит", "ыт", "ую", "ю"}
+	noun              = []string{"иями", "ями", "ами", "иях", "ием", "иям", "ией", "ев", "ов", "ие", "ье", "еи", "ии", "ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья", "а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я"}
+	superlative       = []string{"ейше", "ейш"}
+	derivational      = []string{"ость", "ост"}
+)
+
+func isRussianVowel(r rune) bool {
+	switch r {
+	case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+		return true
+	}
+	return false
+}
+
+// regionAfterVowel returns the index just after the first vowel at or after
+// from, or len(w)
+func regionAfterVowel(w []rune, from int) int {
+	for i := from; i < len(w); i++ {
+		if isRussianVowel(w[i]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// regionAfterConsonant returns the index just after the first non-vowel at
+// or after from, or len(w)
+func regionAfterConsonant(w []rune, from int) int {
+	for i := from; i < len(w); i++ {
+		if !isRussianVowel(w[i]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+func hasSuffix(w []rune, region int, suffix string) bool {
+	s := []rune(suffix)
+	start := len(w) - len(s)
+	if start < region || start < 0 {
+		return false
+	}
+	for i, r := range s {
+		if w[start+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSuffix finds the longest suffix of the group inside the region and
+// returns its length. Group 1 endings of the algorithm only count after а
+// or я, which stays part of the stem.
+func matchSuffix(w []rune, region int, group []string, afterAYa bool) (int, bool) {
+	best := 0
+	for _, s := range group {
+		n := len([]rune(s))
+		if n <= best || !hasSuffix(w, region, s) {
+			continue
+		}
+		if afterAYa {
+			prev := len(w) - n - 1
+			if prev < region || (w[prev] != 'а' && w[prev] != 'я') {
+				continue
+			}
+		}
+		best = n
+	}
+	return best, best > 0
+}
@@ -0,0 +1,37 @@
+package engine
+
+import "testing"
+
+// Expected stems are the output of the reference Snowball Russian stemmer
+func TestStem(t *testing.T) {
+	tests := []struct{ word, stem string }{
+		{"вагон", "вагон"},
+		{"вагона", "вагон"},
+		{"вагонов", "вагон"},
+		{"вагоном", "вагон"},
+		{"важная", "важн"},
+		{"важнейшие", "важн"},
+		{"важного", "важн"},
+		{"вазы", "ваз"},
+		{"вальса", "вальс"},
+		{"вам", "вам"},
+		{"вашего", "ваш"},
+		{"вбежал", "вбежа"},
+		{"вбежала", "вбежа"},
+		{"вдруг", "вдруг"},
+		{"ведь", "вед"},
+		{"конечно", "конечн"},
+		{"красивейший", "красив"},
+		{"ощущение", "ощущен"},
+		{"командами", "команд"},
+		{"чемпионата", "чемпионат"},
+		{"победила", "побед"},
+		{"матчей", "матч"},
+		{"vitality", "vitality"},
+	}
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.stem {
+			t.Errorf("Stem(%q) = %q, want %q", tt.word, got, tt.stem)
+		}
+	}
+}
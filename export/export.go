@@ -1,114 +1,139 @@
-package main
+// Package export streams documents out of the document store in the formats
+// downstream tools consume
+package export
 
 import (
-	"context"
-	"flag"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
+	"sort"
+	"time"
 
 	"corpus_parser/parser"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func main() {
-	var configPath string
-	var outputDir string
-	var limit int
+type Options struct {
+	Format string
+	Output string
 
-	flag.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
-	flag.StringVar(&outputDir, "output", "data", "Output directory for text files")
-	flag.IntVar(&limit, "limit", 0, "Limit number of documents (0 = all)")
-	flag.Parse()
+	// Manifest is the doc id manifest the indexed format assigns ids from
+	Manifest string
 
-	cfg, err := parser.LoadYAMLConfig(configPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
-		os.Exit(1)
-	}
+	Source       string
+	From         time.Time // crawl_time lower bound, zero means unbounded
+	To           time.Time // crawl_time upper bound, exclusive
+	ChangedSince time.Time // only documents whose current version is newer
+	Limit        int
+}
 
-	db, err := parser.NewDatabase(cfg.DB.URI, cfg.DB.Database, cfg.DB.Collection)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
-		os.Exit(1)
-	}
-	defer db.Close()
+type Stats struct {
+	Exported int
+	// Filtered counts the documents ChangedSince left out; the source and
+	// crawl time filters are applied by the store
+	Filtered int
+	Failed   int
+}
+
+// Writer receives the exported documents one by one
+type Writer interface {
+	Write(record *parser.ParsedRecord, doc *parser.Document) error
+	Close() error
+}
 
-	os.MkdirAll(outputDir, 0755)
+var formats = map[string]func(opts Options) (Writer, error){
+	"jsonl": func(opts Options) (Writer, error) { return newJSONLWriter(opts.Output) },
+	"csv":   func(opts Options) (Writer, error) { return newDelimitedWriter(opts.Output, ',') },
+	"tsv":   func(opts Options) (Writer, error) { return newDelimitedWriter(opts.Output, '\t') },
+	"txt":   func(opts Options) (Writer, error) { return newTextDirWriter(opts.Output) },
+	"tar":   func(opts Options) (Writer, error) { return newTarWriter(opts.Output) },
 
-	ctx := context.Background()
-	collection := db.GetCollection()
+	"trec":       func(opts Options) (Writer, error) { return newTRECWriter(opts.Output) },
+	"collection": func(opts Options) (Writer, error) { return newCollectionWriter(opts.Output) },
+	"indexed":    newIndexedWriter,
+}
 
-	filter := bson.M{}
-	opts := options.Find()
-	if limit > 0 {
-		limit64 := int64(limit)
-		opts = opts.SetLimit(limit64)
+// Formats lists the supported output formats
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+var errLimitReached = errors.New("limit reached")
 
-	cursor, err := collection.Find(ctx, filter, opts)
+// Run streams the documents matching opts from store into the chosen format.
+// The stored parsed article is used when it matches the current HTML,
+// otherwise the document is parsed on the fly.
+func Run(store parser.DocumentStore, opts Options) (*Stats, error) {
+	newWriter, ok := formats[opts.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (supported: %v)", opts.Format, Formats())
+	}
+
+	w, err := newWriter(opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to query database: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	count := 0
-	for cursor.Next(ctx) {
-		var doc parser.Document
-		if err := cursor.Decode(&doc); err != nil {
-			fmt.Printf("Error decoding document: %v\n", err)
-			continue
-		}
 
-		var text string
-		if doc.Source == "hltv" {
-			article, err := parser.ParseHLTVArticleFromHTML(doc.RawHTML, doc.URL)
-			if err != nil {
-				fmt.Printf("Error parsing HLTV article %s: %v\n", doc.URL, err)
-				continue
-			}
-			text = article.Title + "\n\n" + article.Content
-		} else if doc.Source == "cybersport" {
-			article, err := parser.ParseCybersportArticleFromHTML(doc.RawHTML, doc.URL)
-			if err != nil {
-				fmt.Printf("Error parsing Cybersport article %s: %v\n", doc.URL, err)
-				continue
-			}
-			text = article.Title + "\n\n" + article.Content
-		} else {
-			continue
+	stats := &Stats{}
+	filter := parser.DocumentFilter{Source: opts.Source, From: opts.From, To: opts.To}
+	err = store.ForEachMatching(filter, func(doc *parser.Document) error {
+		if !opts.changed(doc) {
+			stats.Filtered++
+			return nil
 		}
 
-		if strings.TrimSpace(text) == "" {
-			continue
+		record, err := parsedRecord(store, doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", doc.URL, err)
+			stats.Failed++
+			return nil
 		}
 
-		safeURL := strings.ReplaceAll(doc.URL, "https://", "")
-		safeURL = strings.ReplaceAll(safeURL, "http://", "")
-		safeURL = strings.ReplaceAll(safeURL, "/", "_")
-		safeURL = strings.ReplaceAll(safeURL, "?", "_")
-		safeURL = strings.ReplaceAll(safeURL, "&", "_")
-		if len(safeURL) > 200 {
-			safeURL = safeURL[:200]
+		if err := w.Write(record, doc); err != nil {
+			return err
 		}
-
-		filename := fmt.Sprintf("%s_%s.txt", doc.Source, safeURL)
-		filepath := filepath.Join(outputDir, filename)
-
-		if err := os.WriteFile(filepath, []byte(text), 0644); err != nil {
-			fmt.Printf("Error writing file %s: %v\n", filepath, err)
-			continue
+		stats.Exported++
+		if stats.Exported%1000 == 0 {
+			fmt.Fprintf(os.Stderr, "Exported %d documents...\n", stats.Exported)
 		}
-
-		count++
-		if count%100 == 0 {
-			fmt.Printf("Exported %d documents...\n", count)
+		if opts.Limit > 0 && stats.Exported >= opts.Limit {
+			return errLimitReached
 		}
+		return nil
+	})
+
+	if closeErr := w.Close(); err == nil || errors.Is(err, errLimitReached) {
+		err = closeErr
 	}
+	return stats, err
+}
 
-	fmt.Printf("Total exported: %d documents\n", count)
+// changed reports whether the current version of doc passes ChangedSince
+func (opts Options) changed(doc *parser.Document) bool {
+	if opts.ChangedSince.IsZero() {
+		return true
+	}
+	versions := parser.DocumentVersions(doc)
+	current := versions[len(versions)-1]
+	return !time.Unix(current.FetchedAt, 0).Before(opts.ChangedSince)
 }
 
+func parsedRecord(store parser.DocumentStore, doc *parser.Document) (*parser.ParsedRecord, error) {
+	record, err := store.GetParsed(doc.URL)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil && record.RawHash == doc.HTMLHash && record.ExtractorVersion == parser.ExtractorVersion {
+		return record, nil
+	}
+
+	article, err := parser.ParseArticleFromHTML(doc.Source, doc.RawHTML, doc.URL)
+	if err != nil {
+		return nil, err
+	}
+	return parser.NewParsedRecord(parser.DocIDFromURL(doc.Source, doc.URL), article, doc.HTMLHash), nil
+}
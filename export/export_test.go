@@ -0,0 +1,266 @@
+package export
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"corpus_parser/parser"
+)
+
+// stubStore serves a fixed document list and their parsed articles; the
+// rest of DocumentStore is left nil and panics when used
+type stubStore struct {
+	parser.DocumentStore
+	docs   []*parser.Document
+	parsed map[string]*parser.ParsedRecord
+}
+
+func (s *stubStore) ForEachMatching(filter parser.DocumentFilter, fn func(*parser.Document) error) error {
+	for _, doc := range s.docs {
+		if !filter.Matches(doc.Source, doc.CrawlTime) {
+			continue
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stubStore) GetParsed(url string) (*parser.ParsedRecord, error) {
+	return s.parsed[url], nil
+}
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// newStubStore holds two hltv articles crawled in July and August and a
+// cybersport one crawled last whose current version was fetched in June
+func newStubStore() *stubStore {
+	s := &stubStore{parsed: make(map[string]*parser.ParsedRecord)}
+	add := func(docID, source, url, crawled, fetched string) {
+		hash := "hash-" + docID
+		doc := &parser.Document{URL: url, Source: source, CrawlTime: day(crawled).Unix(), HTMLHash: hash}
+		if fetched != "" {
+			doc.Versions = []parser.DocumentVersion{{Hash: hash, FetchedAt: day(fetched).Unix(), RawRef: hash}}
+		}
+		s.docs = append(s.docs, doc)
+		s.parsed[url] = &parser.ParsedRecord{
+			DocID:            docID,
+			Source:           source,
+			URL:              url,
+			Title:            "Title of " + docID,
+			Paragraphs:       []string{"Body of " + docID},
+			RawHash:          hash,
+			ExtractorVersion: parser.ExtractorVersion,
+		}
+	}
+	add("hltv-1", "hltv", "https://www.hltv.org/news/1/a", "2024-07-01", "")
+	add("hltv-2", "hltv", "https://www.hltv.org/news/2/b", "2024-08-01", "")
+	add("cybersport-c", "cybersport", "https://www.cybersport.ru/tags/cs2/c", "2024-08-15", "2024-06-01")
+	return s
+}
+
+func TestRunFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		want     []string
+		filtered int
+	}{
+		{name: "all", want: []string{"hltv-1", "hltv-2", "cybersport-c"}},
+		{name: "source", opts: Options{Source: "hltv"}, want: []string{"hltv-1", "hltv-2"}},
+		{name: "from", opts: Options{From: day("2024-08-01")}, want: []string{"hltv-2", "cybersport-c"}},
+		{name: "to is exclusive", opts: Options{To: day("2024-08-01")}, want: []string{"hltv-1"}},
+		{name: "from and to", opts: Options{From: day("2024-07-15"), To: day("2024-08-10")}, want: []string{"hltv-2"}},
+		// cybersport-c was crawled last but its current version is older
+		{name: "changed since", opts: Options{ChangedSince: day("2024-07-15")}, want: []string{"hltv-2"}, filtered: 2},
+		{name: "limit", opts: Options{Limit: 2}, want: []string{"hltv-1", "hltv-2"}},
+		{name: "limit after filter", opts: Options{Source: "hltv", Limit: 1}, want: []string{"hltv-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Format = "jsonl"
+			opts.Output = filepath.Join(t.TempDir(), "out.jsonl")
+
+			stats, err := Run(newStubStore(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := readJSONLDocIDs(t, opts.Output)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+			if stats.Exported != len(tt.want) || stats.Filtered != tt.filtered || stats.Failed != 0 {
+				t.Errorf("stats %+v, want %d exported and %d filtered", stats, len(tt.want), tt.filtered)
+			}
+		})
+	}
+}
+
+func readJSONLDocIDs(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record parser.ParsedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, record.DocID)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// Every format writes the files downstream tools look for under stable names
+func TestRunFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		output string
+		files  []string
+	}{
+		{format: "jsonl", output: "out.jsonl", files: []string{"out.jsonl"}},
+		{format: "csv", output: "out.csv", files: []string{"out.csv"}},
+		{format: "tsv", output: "out.tsv", files: []string{"out.tsv"}},
+		{format: "txt", output: "data",
+			files: []string{"data/cybersport-c.txt", "data/hltv-1.txt", "data/hltv-2.txt"}},
+		{format: "tar", output: "out.tar", files: []string{"out.tar"}},
+		{format: "trec", output: "out.trec", files: []string{"out.trec", "out.trec.docids.tsv"}},
+		{format: "collection", output: "out.jsonl", files: []string{"out.jsonl", "out.jsonl.docids.tsv"}},
+		{format: "indexed", output: "indexed",
+			files: []string{"indexed/00000000.txt", "indexed/00000001.txt", "indexed/00000002.txt", "manifest.tsv"}},
+	}
+	if len(tests) != len(Formats()) {
+		t.Errorf("test covers %d formats, the exporter has %v", len(tests), Formats())
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := Options{
+				Format:   tt.format,
+				Output:   filepath.Join(dir, tt.output),
+				Manifest: filepath.Join(dir, "manifest.tsv"),
+			}
+			stats, err := Run(newStubStore(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Exported != 3 {
+				t.Errorf("exported %d documents, want 3", stats.Exported)
+			}
+			if got := listFiles(t, dir); !reflect.DeepEqual(got, tt.files) {
+				t.Errorf("wrote %v, want %v", got, tt.files)
+			}
+		})
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestTarEntryNames(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.tar")
+	if _, err := Run(newStubStore(), Options{Format: "tar", Output: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	r := tar.NewReader(f)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+	}
+	want := []string{"hltv/hltv-1.txt", "hltv/hltv-2.txt", "cybersport/cybersport-c.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("tar entries %v, want %v", names, want)
+	}
+}
+
+// A filtered indexed export keeps the files earlier runs wrote for the ids
+// it leaves out and only fills the gaps with placeholders
+func TestIndexedFilteredRerun(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{
+		Format:   "indexed",
+		Output:   filepath.Join(dir, "indexed"),
+		Manifest: filepath.Join(dir, "manifest.tsv"),
+		Source:   "hltv",
+	}
+	if _, err := Run(newStubStore(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Source = "cybersport"
+	if _, err := Run(newStubStore(), opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.Source = "hltv"
+	opts.To = day("2024-08-01")
+	if _, err := Run(newStubStore(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"00000000.txt": parser.RenderText("Title of hltv-1", "Body of hltv-1"),
+		"00000001.txt": parser.RenderText("Title of hltv-2", "Body of hltv-2"),
+		"00000002.txt": parser.RenderText("Title of cybersport-c", "Body of cybersport-c"),
+	}
+	for name, text := range want {
+		data, err := os.ReadFile(filepath.Join(opts.Output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != text {
+			t.Errorf("%s holds %q, want %q", name, data, text)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"corpus_parser/parser"
+)
+
+var indexedFileRe = regexp.MustCompile(`^(\d{8})\.txt$`)
+
+// indexedWriter writes the text view of each document as <docid>.txt with
+// the integer id from the manifest. The C++ index_builder numbers files in
+// name order, so the directory is completed with empty files for ids that
+// have no file yet; file N then always gets BOOLEAN_INDEX id N.
+type indexedWriter struct {
+	dir      string
+	manifest *parser.Manifest
+	written  map[int]bool
+}
+
+func newIndexedWriter(opts Options) (Writer, error) {
+	dir := opts.Output
+	if dir == "" || dir == "-" {
+		return nil, fmt.Errorf("indexed export needs an output directory")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	manifestPath := opts.Manifest
+	if manifestPath == "" {
+		manifestPath = parser.DefaultManifestPath
+	}
+	manifest, err := parser.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	return &indexedWriter{dir: dir, manifest: manifest, written: make(map[int]bool)}, nil
+}
+
+func (w *indexedWriter) Write(record *parser.ParsedRecord, doc *parser.Document) error {
+	entry := w.manifest.Record(record)
+	entry.Hash = doc.HTMLHash
+
+	path := filepath.Join(w.dir, parser.IndexedFileName(entry.ID))
+	entry.ParsedPath = path
+	w.written[entry.ID] = true
+
+	return os.WriteFile(path, []byte(parser.RenderText(record.Title, record.Body())), 0644)
+}
+
+func (w *indexedWriter) Close() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	// Files of ids that no longer exist in the manifest range are stale
+	for _, e := range entries {
+		m := indexedFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		if id, _ := strconv.Atoi(m[1]); id >= w.manifest.Len() {
+			os.Remove(filepath.Join(w.dir, e.Name()))
+		}
+	}
+
+	placeholders := 0
+	for id := 0; id < w.manifest.Len(); id++ {
+		if w.written[id] {
+			continue
+		}
+		// A filtered export keeps the text earlier runs wrote for other ids
+		path := filepath.Join(w.dir, parser.IndexedFileName(id))
+		if _, err := os.Stat(path); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			return err
+		}
+		placeholders++
+	}
+	if placeholders > 0 {
+		fmt.Fprintf(os.Stderr, "Wrote %d empty placeholder files for ids not in this export\n", placeholders)
+	}
+
+	return w.manifest.Save()
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	"corpus_parser/parser"
+)
+
+// docMap is the companion docid -> URL/title table written next to the
+// evaluation formats, so run files can be mapped back to articles
+type docMap struct {
+	out *outputFile
+}
+
+// DocMapPath returns where the docid map of an export output goes
+func DocMapPath(output string) string {
+	if output == "" || output == "-" {
+		return "docids.tsv"
+	}
+	return output + ".docids.tsv"
+}
+
+func newDocMap(output string) (*docMap, error) {
+	out, err := createOutput(DocMapPath(output))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "docid\turl\ttitle\n")
+	return &docMap{out: out}, nil
+}
+
+func (m *docMap) add(record *parser.ParsedRecord) {
+	fmt.Fprintf(m.out, "%s\t%s\t%s\n", record.DocID, record.URL, singleLine(record.Title))
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// trecWriter writes TREC SGML, one <DOC> per article with the doc id as
+// DOCNO
+type trecWriter struct {
+	out  *outputFile
+	docs *docMap
+}
+
+func newTRECWriter(output string) (Writer, error) {
+	out, err := createOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := newDocMap(output)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &trecWriter{out: out, docs: docs}, nil
+}
+
+func (w *trecWriter) Write(record *parser.ParsedRecord, _ *parser.Document) error {
+	fmt.Fprintf(w.out, "<DOC>\n<DOCNO>%s</DOCNO>\n", record.DocID)
+	fmt.Fprintf(w.out, "<URL>%s</URL>\n", html.EscapeString(record.URL))
+	fmt.Fprintf(w.out, "<HEADLINE>%s</HEADLINE>\n", html.EscapeString(singleLine(record.Title)))
+	if _, err := fmt.Fprintf(w.out, "<TEXT>\n%s\n</TEXT>\n</DOC>\n", html.EscapeString(record.Body())); err != nil {
+		return err
+	}
+	w.docs.add(record)
+	return nil
+}
+
+func (w *trecWriter) Close() error {
+	if err := w.docs.out.Close(); err != nil {
+		w.out.Close()
+		return err
+	}
+	return w.out.Close()
+}
+
+// collectionWriter writes the {"id", "contents"} JSONL collection layout
+// that Anserini and Pyserini index directly
+type collectionWriter struct {
+	out  *outputFile
+	enc  *json.Encoder
+	docs *docMap
+}
+
+type collectionDoc struct {
+	ID       string `json:"id"`
+	Contents string `json:"contents"`
+}
+
+func newCollectionWriter(output string) (Writer, error) {
+	out, err := createOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := newDocMap(output)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	return &collectionWriter{out: out, enc: enc, docs: docs}, nil
+}
+
+func (w *collectionWriter) Write(record *parser.ParsedRecord, _ *parser.Document) error {
+	doc := collectionDoc{ID: record.DocID, Contents: record.Title + "\n\n" + record.Body()}
+	if err := w.enc.Encode(doc); err != nil {
+		return err
+	}
+	w.docs.add(record)
+	return nil
+}
+
+func (w *collectionWriter) Close() error {
+	if err := w.docs.out.Close(); err != nil {
+		w.out.Close()
+		return err
+	}
+	return w.out.Close()
+}
+
+// WriteTopics converts a plain query list, one query per line, into TREC
+// topic format numbered from 1. Blank lines and lines starting with # are
+// skipped.
+func WriteTopics(queries io.Reader, output string) (int, error) {
+	out, err := createOutput(output)
+	if err != nil {
+		return 0, err
+	}
+
+	scanner := bufio.NewScanner(queries)
+	num := 0
+	for scanner.Scan() {
+		query := strings.TrimSpace(scanner.Text())
+		if query == "" || strings.HasPrefix(query, "#") {
+			continue
+		}
+		num++
+		fmt.Fprintf(out, "<top>\n<num> Number: %d\n<title> %s\n\n<desc> Description:\n\n<narr> Narrative:\n\n</top>\n\n", num, html.EscapeString(query))
+	}
+	if err := scanner.Err(); err != nil {
+		out.Close()
+		return num, err
+	}
+	return num, out.Close()
+}
+
+// WriteTopicsFile is WriteTopics over a query list file
+func WriteTopicsFile(queriesPath, output string) (int, error) {
+	f, err := os.Open(queriesPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return WriteTopics(f, output)
+}
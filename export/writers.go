@@ -0,0 +1,196 @@
+package export
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"corpus_parser/parser"
+)
+
+// outputFile opens output for writing; "-" and "" mean stdout
+type outputFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func createOutput(output string) (*outputFile, error) {
+	if output == "" || output == "-" {
+		return &outputFile{Writer: bufio.NewWriter(os.Stdout)}, nil
+	}
+	if dir := filepath.Dir(output); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{Writer: bufio.NewWriter(f), file: f}, nil
+}
+
+func (o *outputFile) Close() error {
+	if err := o.Flush(); err != nil {
+		return err
+	}
+	if o.file != nil {
+		return o.file.Close()
+	}
+	return nil
+}
+
+type jsonlWriter struct {
+	out *outputFile
+	enc *json.Encoder
+}
+
+func newJSONLWriter(output string) (Writer, error) {
+	out, err := createOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{out: out, enc: enc}, nil
+}
+
+func (w *jsonlWriter) Write(record *parser.ParsedRecord, _ *parser.Document) error {
+	return w.enc.Encode(record)
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.out.Close()
+}
+
+var delimitedHeader = []string{"doc_id", "source", "url", "title", "published", "crawl_time", "text"}
+
+type delimitedWriter struct {
+	out *outputFile
+	csv *csv.Writer
+	tsv bool
+}
+
+func newDelimitedWriter(output string, comma rune) (Writer, error) {
+	out, err := createOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(out)
+	w.Comma = comma
+	if err := w.Write(delimitedHeader); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &delimitedWriter{out: out, csv: w, tsv: comma == '\t'}, nil
+}
+
+func (w *delimitedWriter) Write(record *parser.ParsedRecord, doc *parser.Document) error {
+	text := record.Body()
+	if w.tsv {
+		// Keep one document per line for line-oriented tools
+		text = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(text)
+	}
+	return w.csv.Write([]string{
+		record.DocID,
+		record.Source,
+		record.URL,
+		record.Title,
+		record.Metadata.Published,
+		time.Unix(doc.CrawlTime, 0).UTC().Format(time.RFC3339),
+		text,
+	})
+}
+
+func (w *delimitedWriter) Close() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		w.out.Close()
+		return err
+	}
+	return w.out.Close()
+}
+
+// textDirWriter writes <doc_id>.txt files, the layout the C++ tools read
+type textDirWriter struct {
+	dir string
+}
+
+func newTextDirWriter(output string) (Writer, error) {
+	if output == "" || output == "-" {
+		output = "data"
+	}
+	if err := os.MkdirAll(output, 0755); err != nil {
+		return nil, err
+	}
+	return &textDirWriter{dir: output}, nil
+}
+
+func (w *textDirWriter) Write(record *parser.ParsedRecord, _ *parser.Document) error {
+	path := filepath.Join(w.dir, record.DocID+".txt")
+	return os.WriteFile(path, []byte(parser.RenderText(record.Title, record.Body())), 0644)
+}
+
+func (w *textDirWriter) Close() error {
+	return nil
+}
+
+// tarWriter packs the text view of every document into one tarball, gzipped
+// when the output name ends in .gz or .tgz
+type tarWriter struct {
+	out *outputFile
+	gz  *gzip.Writer
+	tar *tar.Writer
+}
+
+func newTarWriter(output string) (Writer, error) {
+	out, err := createOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	w := &tarWriter{out: out}
+
+	var dst io.Writer = out
+	if strings.HasSuffix(output, ".gz") || strings.HasSuffix(output, ".tgz") {
+		w.gz = gzip.NewWriter(out)
+		dst = w.gz
+	}
+	w.tar = tar.NewWriter(dst)
+	return w, nil
+}
+
+func (w *tarWriter) Write(record *parser.ParsedRecord, doc *parser.Document) error {
+	data := []byte(parser.RenderText(record.Title, record.Body()))
+	header := &tar.Header{
+		Name:    record.Source + "/" + record.DocID + ".txt",
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Unix(doc.CrawlTime, 0),
+	}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.tar.Write(data)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tar.Close(); err != nil {
+		w.out.Close()
+		return err
+	}
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.out.Close()
+			return err
+		}
+	}
+	return w.out.Close()
+}
@@ -4,13 +4,18 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"html"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"corpus_parser/engine"
+	"corpus_parser/export"
 	"corpus_parser/parser"
 
 	"github.com/cheggaaa/pb/v3"
@@ -35,6 +40,61 @@ func main() {
 			return
 		}
 
+		if firstArg == "serve-mirror" {
+			runServeMirror()
+			return
+		}
+
+		if firstArg == "add-fixture" {
+			runAddFixture()
+			return
+		}
+
+		if firstArg == "migrate" {
+			runMigrate()
+			return
+		}
+
+		if firstArg == "reparse" {
+			runReparse()
+			return
+		}
+
+		if firstArg == "export" {
+			runExport()
+			return
+		}
+
+		if firstArg == "versions" {
+			runVersions()
+			return
+		}
+
+		if firstArg == "diff" {
+			runDiff()
+			return
+		}
+
+		if firstArg == "index" {
+			runIndex()
+			return
+		}
+
+		if firstArg == "serve" {
+			runServe()
+			return
+		}
+
+		if firstArg == "search" {
+			runSearch()
+			return
+		}
+
+		if firstArg == "query" {
+			runQuery()
+			return
+		}
+
 		if strings.HasSuffix(firstArg, ".yaml") || strings.HasSuffix(firstArg, ".yml") {
 			if _, err := os.Stat(firstArg); err == nil {
 				runYAMLMode(firstArg)
@@ -55,14 +115,26 @@ func runYAMLMode(configPath string) {
 
 	rand.Seed(time.Now().UnixNano())
 
-	db, err := parser.NewDatabase(cfg.DB.URI, cfg.DB.Database, cfg.DB.Collection)
+	parser.SetBaseURLs(cfg.Sites.HLTV.BaseURL, cfg.Sites.Cybersport.BaseURL)
+	parser.Throttle = parser.NewThrottleController(cfg.Throttle)
+	parser.Breakers = parser.NewBreakerSet(cfg.Breaker)
+
+	if cfg.Cassette.Mode != "" {
+		useCassette(cfg.Cassette.Dir, cfg.Cassette.Mode)
+		if parser.Replaying() {
+			cfg.Browser.UseBrowser = false
+			cfg.Browser.Hybrid = false
+		}
+	}
+
+	db, err := parser.OpenDocumentStore(cfg.DB)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to open document store: %v\n", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	fmt.Println("Connected to MongoDB successfully")
+	fmt.Printf("Connected to %s successfully\n", parser.DescribeStore(cfg.DB))
 
 	corpusDir := "corpus"
 	os.MkdirAll(corpusDir, 0755)
@@ -72,11 +144,16 @@ func runYAMLMode(configPath string) {
 
 	stats := &parser.Statistics{
 		CorpusPath:  corpusDir,
-		BrowserMode: cfg.Browser.UseBrowser,
+		BrowserMode: cfg.Browser.UseBrowser && !cfg.Browser.Hybrid,
+		HybridMode:  cfg.Browser.Hybrid,
 	}
 	startTime := time.Now()
 
-	if cfg.Browser.UseBrowser {
+	if cfg.Browser.Hybrid {
+		fmt.Println("Hybrid mode: HTTP first, browser only for anti-bot pages")
+		parser.Hybrid = parser.NewHybridFetcher(cfg.Browser.ShowBrowser, cfg.Browser.BrowserDebug)
+		defer parser.Hybrid.Close()
+	} else if cfg.Browser.UseBrowser {
 		fmt.Println("Initializing browser...")
 		var err error
 		parser.Browser, err = parser.InitBrowser(cfg.Browser.ShowBrowser, cfg.Browser.BrowserDebug)
@@ -195,6 +272,14 @@ func runYAMLMode(configPath string) {
 		ReCrawl:       reCrawlEnabled,
 		ReCrawlInt:    cfg.Logic.ReCrawlInterval,
 		ResumeFromURL: resumeURL,
+		Writer:        parser.NewBatchWriter(db, cfg.DB.BatchSize, 2*time.Second),
+	}
+	crawlerCfg.Writer.AddListener(parser.NewManifestRecorder(parser.DefaultManifestPath))
+	var indexer *engine.Indexer
+	if cfg.Index.Live {
+		indexer = engine.NewIndexer(cfg.Index.Path, engine.NewEntityMatcher(cfg.Index.Entities))
+		crawlerCfg.Writer.AddListener(indexer)
+		fmt.Printf("Live indexing into %s\n", cfg.Index.Path)
 	}
 
 	workersCount := 0
@@ -228,12 +313,36 @@ func runYAMLMode(configPath string) {
 	wg.Wait()
 	bar.Finish()
 
+	if err := crawlerCfg.Writer.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write the last documents: %v\n", err)
+	}
+	warnIndexPending(indexer)
+
 	stats.DownloadTime = time.Since(startTime).String()
+	stats.Throttle = parser.Throttle.Snapshot()
+	stats.FetchPaths = parser.FetchPaths()
+	stats.BreakerTransitions = parser.Breakers.Transitions()
+	if parser.ActiveCassette != nil {
+		cassetteStats := parser.ActiveCassette.Stats()
+		stats.Cassette = &cassetteStats
+	}
 
 	statsJSON, _ := json.MarshalIndent(stats, "", "  ")
 	os.WriteFile(filepath.Join(corpusDir, "statistics.json"), statsJSON, 0644)
 
 	fmt.Printf("\nCompleted. Downloaded articles: %d\n", stats.TotalArticles)
+	fmt.Printf("Pages served: %d over HTTP, %d by browser (%d escalations, %d de-escalations)\n",
+		stats.FetchPaths.HTTPPages, stats.FetchPaths.BrowserPages, stats.FetchPaths.Escalations, stats.FetchPaths.Deescalations)
+	for _, t := range stats.Throttle {
+		fmt.Printf("Throttle %s: %.2f req/s, concurrency %d, %d throttled responses\n", t.Host, t.Rate, t.Concurrency, t.Throttled)
+	}
+	if len(stats.BreakerTransitions) > 0 {
+		fmt.Printf("Circuit breaker transitions: %d (see statistics.json)\n", len(stats.BreakerTransitions))
+	}
+	if stats.Cassette != nil {
+		fmt.Printf("Cassette (%s): %d recorded, %d hits, %d misses\n",
+			stats.Cassette.Mode, stats.Cassette.Recorded, stats.Cassette.Hits, stats.Cassette.Misses)
+	}
 	fmt.Printf("Statistics saved to %s/statistics.json\n", corpusDir)
 }
 
@@ -241,15 +350,34 @@ func runLegacyMode() {
 	cfg := &parser.Config{}
 
 	flag.BoolVar(&cfg.UseBrowser, "b", false, "Use browser to bypass Cloudflare")
-	flag.BoolVar(&cfg.ShowBrowser, "show", false, "Show browser window (only with -b)")
+	flag.BoolVar(&cfg.Hybrid, "hybrid", false, "Fetch over HTTP and escalate anti-bot pages to the browser")
+	flag.BoolVar(&cfg.ShowBrowser, "show", false, "Show browser window (only with -b or -hybrid)")
 	flag.BoolVar(&cfg.BrowserDebug, "debug", false, "Enable browser debug mode")
 	flag.BoolVar(&cfg.CollectOnly, "collect-only", false, "Only collect article links and save to CSV")
 	flag.BoolVar(&cfg.DownloadOnly, "download-only", false, "Only download articles from CSV files (skip collection)")
 	flag.IntVar(&cfg.Workers, "workers", 4, "Number of parallel workers for downloading (default: 4)")
 	flag.StringVar(&cfg.Site, "site", "both", "Which site to process: hltv, cybersport, both")
+	flag.StringVar(&cfg.RecordDir, "record", "", "Record every fetched page to this cassette directory")
+	flag.StringVar(&cfg.ReplayDir, "replay", "", "Serve fetches only from this cassette directory")
+	flag.StringVar(&cfg.HLTVBaseURL, "hltv-url", "", "Base URL of HLTV (default: https://www.hltv.org)")
+	flag.StringVar(&cfg.CybersportBaseURL, "cybersport-url", "", "Base URL of Cybersport (default: https://www.cybersport.ru)")
 	flag.Parse()
 
 	rand.Seed(time.Now().UnixNano())
+	parser.SetBaseURLs(cfg.HLTVBaseURL, cfg.CybersportBaseURL)
+
+	if cfg.RecordDir != "" && cfg.ReplayDir != "" {
+		fmt.Fprintf(os.Stderr, "Error: -record and -replay are mutually exclusive\n")
+		os.Exit(1)
+	}
+	if cfg.RecordDir != "" {
+		useCassette(cfg.RecordDir, parser.CassetteRecord)
+	}
+	if cfg.ReplayDir != "" {
+		useCassette(cfg.ReplayDir, parser.CassetteReplay)
+		cfg.UseBrowser = false
+		cfg.Hybrid = false
+	}
 
 	corpusDir := "corpus"
 	os.MkdirAll(corpusDir, 0755)
@@ -259,11 +387,16 @@ func runLegacyMode() {
 
 	stats := &parser.Statistics{
 		CorpusPath:  corpusDir,
-		BrowserMode: cfg.UseBrowser,
+		BrowserMode: cfg.UseBrowser && !cfg.Hybrid,
+		HybridMode:  cfg.Hybrid,
 	}
 	startTime := time.Now()
 
-	if cfg.UseBrowser {
+	if cfg.Hybrid {
+		fmt.Println("Hybrid mode: HTTP first, browser only for anti-bot pages")
+		parser.Hybrid = parser.NewHybridFetcher(cfg.ShowBrowser, cfg.BrowserDebug)
+		defer parser.Hybrid.Close()
+	} else if cfg.UseBrowser {
 		fmt.Println("Initializing browser...")
 		var err error
 		parser.Browser, err = parser.InitBrowser(cfg.ShowBrowser, cfg.BrowserDebug)
@@ -393,21 +526,97 @@ func runLegacyMode() {
 	bar.Finish()
 
 	stats.DownloadTime = time.Since(startTime).String()
+	stats.Throttle = parser.Throttle.Snapshot()
+	stats.FetchPaths = parser.FetchPaths()
+	stats.BreakerTransitions = parser.Breakers.Transitions()
+	if parser.ActiveCassette != nil {
+		cassetteStats := parser.ActiveCassette.Stats()
+		stats.Cassette = &cassetteStats
+	}
 
 	statsJSON, _ := json.MarshalIndent(stats, "", "  ")
 	os.WriteFile(filepath.Join(corpusDir, "statistics.json"), statsJSON, 0644)
 
 	fmt.Printf("\nCompleted. Downloaded articles: %d\n", stats.TotalArticles)
+	fmt.Printf("Pages served: %d over HTTP, %d by browser (%d escalations, %d de-escalations)\n",
+		stats.FetchPaths.HTTPPages, stats.FetchPaths.BrowserPages, stats.FetchPaths.Escalations, stats.FetchPaths.Deescalations)
+	for _, t := range stats.Throttle {
+		fmt.Printf("Throttle %s: %.2f req/s, concurrency %d, %d throttled responses\n", t.Host, t.Rate, t.Concurrency, t.Throttled)
+	}
+	if len(stats.BreakerTransitions) > 0 {
+		fmt.Printf("Circuit breaker transitions: %d (see statistics.json)\n", len(stats.BreakerTransitions))
+	}
+	if stats.Cassette != nil {
+		fmt.Printf("Cassette (%s): %d recorded, %d hits, %d misses\n",
+			stats.Cassette.Mode, stats.Cassette.Recorded, stats.Cassette.Hits, stats.Cassette.Misses)
+	}
 	fmt.Printf("Statistics saved to %s/statistics.json\n", corpusDir)
 }
 
+func useCassette(dir, mode string) {
+	cassette, err := parser.OpenCassette(dir, mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open cassette: %v\n", err)
+		os.Exit(1)
+	}
+	parser.UseCassette(cassette)
+	fmt.Printf("Cassette %s mode: %s\n", mode, dir)
+}
+
+// loadConfig loads the YAML config, exiting on failure
+func loadConfig(configPath string) *parser.YAMLConfig {
+	cfg, err := parser.LoadYAMLConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// openStore loads the YAML config and opens its document store, exiting on
+// failure
+func openStore(configPath string) parser.DocumentStore {
+	cfg := loadConfig(configPath)
+	parser.SetBaseURLs(cfg.Sites.HLTV.BaseURL, cfg.Sites.Cybersport.BaseURL)
+
+	db, err := parser.OpenDocumentStore(cfg.DB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open document store: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Connected to %s\n\n", parser.DescribeStore(cfg.DB))
+	return db
+}
+
+// loadStoredDocument fetches a document by URL, exiting if it is unknown
+func loadStoredDocument(db parser.DocumentStore, rawURL string) *parser.Document {
+	normalizedURL, err := parser.NormalizeURL(rawURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid URL: %v\n", err)
+		os.Exit(1)
+	}
+
+	doc, err := db.GetDocument(normalizedURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load document: %v\n", err)
+		os.Exit(1)
+	}
+	if doc == nil {
+		fmt.Fprintf(os.Stderr, "No document stored for %s\n", normalizedURL)
+		os.Exit(1)
+	}
+	return doc
+}
+
 func runAddToDB() {
-	var configPath string
+	var configPath, manifestPath string
 	var source string
 
 	flagSet := flag.NewFlagSet("add-to-db", flag.ExitOnError)
 	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
 	flagSet.StringVar(&source, "source", "", "Source to add: hltv or cybersport (required)")
+	flagSet.StringVar(&manifestPath, "manifest", parser.DefaultManifestPath, "Doc id manifest to assign ids of parsed articles in")
 	flagSet.Parse(os.Args[2:])
 
 	if source == "" {
@@ -421,23 +630,11 @@ func runAddToDB() {
 		os.Exit(1)
 	}
 
-	cfg, err := parser.LoadYAMLConfig(configPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
-		os.Exit(1)
-	}
-
-	db, err := parser.NewDatabase(cfg.DB.URI, cfg.DB.Database, cfg.DB.Collection)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
-		os.Exit(1)
-	}
+	db := openStore(configPath)
 	defer db.Close()
 
-	fmt.Printf("Connected to MongoDB\n\n")
-
 	corpusDir := "corpus"
-	if err := parser.AddExistingPagesToDB(corpusDir, db, source); err != nil {
+	if err := parser.AddExistingPagesToDB(corpusDir, db, source, parser.NewManifestRecorder(manifestPath)); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -445,8 +642,12 @@ func runAddToDB() {
 
 func runParse() {
 	var site string
+	var workers int
+	var force bool
 	flagSet := flag.NewFlagSet("parse", flag.ExitOnError)
 	flagSet.StringVar(&site, "site", "both", "Site to parse: hltv, cybersport, or both")
+	flagSet.IntVar(&workers, "workers", runtime.NumCPU(), "Number of parallel parse workers")
+	flagSet.BoolVar(&force, "force", false, "Re-parse every file, even if unchanged since the last parse")
 	flagSet.Parse(os.Args[2:])
 
 	corpusDir := "corpus"
@@ -462,25 +663,657 @@ func runParse() {
 	fmt.Printf("Parsing raw documents\n")
 	fmt.Printf("=====================================\n\n")
 
-	if site == "hltv" || site == "both" {
-		fmt.Println("Processing HLTV articles...")
-		if err := parser.ProcessHLTVRawFiles(corpusDir); err != nil {
-			fmt.Printf("Error processing HLTV: %v\n", err)
-		} else {
-			fmt.Println("HLTV processing completed")
+	opts := parser.ParseOptions{Workers: workers, Force: force}
+
+	for _, source := range []string{"hltv", "cybersport"} {
+		if site != source && site != "both" {
+			continue
+		}
+
+		fmt.Printf("Processing %s articles...\n", source)
+		summary, err := parser.ProcessRawFiles(corpusDir, source, opts)
+		if summary != nil {
+			parser.PrintParseSummary(summary)
+		}
+		if err != nil {
+			fmt.Printf("Error processing %s: %v\n", source, err)
 		}
 	}
 
-	if site == "cybersport" || site == "both" {
-		fmt.Println("Processing Cybersport articles...")
-		if err := parser.ProcessCybersportRawFiles(corpusDir); err != nil {
-			fmt.Printf("Error processing Cybersport: %v\n", err)
-		} else {
-			fmt.Println("Cybersport processing completed")
+	fmt.Printf("Parsing completed\n\n")
+}
+
+func runServeMirror() {
+	var addr string
+	var corpusDir string
+	var site string
+	var delayMs int
+
+	flagSet := flag.NewFlagSet("serve-mirror", flag.ExitOnError)
+	flagSet.StringVar(&addr, "addr", "localhost:8080", "Address to listen on")
+	flagSet.StringVar(&corpusDir, "corpus", "corpus", "Corpus directory with <site>/raw trees")
+	flagSet.StringVar(&site, "site", "both", "Site to serve: hltv, cybersport, or both")
+	flagSet.IntVar(&delayMs, "delay", 0, "Artificial delay per response in milliseconds")
+	flagSet.Parse(os.Args[2:])
+
+	var sites []string
+	switch strings.ToLower(site) {
+	case "hltv", "cybersport":
+		sites = []string{strings.ToLower(site)}
+	default:
+		sites = []string{"hltv", "cybersport"}
+	}
+
+	mirror, err := parser.NewMirror(corpusDir, sites)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load mirror: %v\n", err)
+		os.Exit(1)
+	}
+	mirror.Delay = time.Duration(delayMs) * time.Millisecond
+
+	fmt.Printf("Serving %s mirror on http://%s\n", strings.Join(sites, " and "), addr)
+	fmt.Printf("Point sites.<site>.base_url in config.yaml at it to crawl the mirror\n")
+	if err := http.ListenAndServe(addr, mirror); err != nil {
+		fmt.Fprintf(os.Stderr, "Mirror server failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runAddFixture() {
+	var source string
+	var rawPath string
+	var name string
+	var sourceURL string
+
+	flagSet := flag.NewFlagSet("add-fixture", flag.ExitOnError)
+	flagSet.StringVar(&source, "source", "", "Source of the page: hltv or cybersport (required)")
+	flagSet.StringVar(&rawPath, "file", "", "Raw HTML page from the corpus (required)")
+	flagSet.StringVar(&name, "name", "", "Fixture name (default: raw file name)")
+	flagSet.StringVar(&sourceURL, "url", "", "Original URL of the page")
+	flagSet.Parse(os.Args[2:])
+
+	if source == "" || rawPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: -source and -file are required\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	htmlPath, err := parser.AddFixture(parser.FixtureDir, source, rawPath, name, sourceURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Fixture added: %s\n", htmlPath)
+	fmt.Printf("Golden written: %s\n", parser.GoldenPath(htmlPath))
+	fmt.Printf("Review it, then run: go test ./parser -run Golden\n")
+	fmt.Printf("After extractor changes, regenerate with: go test ./parser -run Golden -update\n")
+}
+
+func runMigrate() {
+	var configPath string
+	var status bool
+
+	flagSet := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.BoolVar(&status, "status", false, "Only print the current schema version")
+	flagSet.Parse(os.Args[2:])
+
+	db := openStore(configPath)
+	defer db.Close()
+
+	migrator, ok := db.(parser.Migrator)
+	if !ok {
+		fmt.Println("This document store has no schema migrations")
+		return
+	}
+
+	version, err := migrator.SchemaVersion()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read schema version: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Schema version: %d (latest %d)\n", version, parser.LatestSchemaVersion())
+	if status {
+		return
+	}
+
+	applied, err := migrator.Migrate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date")
+		return
+	}
+	fmt.Printf("Applied %d migrations, schema version is now %d\n", len(applied), applied[len(applied)-1].Version)
+}
+
+func runReparse() {
+	var configPath, manifestPath string
+	var source string
+	var workers int
+	var force bool
+
+	flagSet := flag.NewFlagSet("reparse", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.StringVar(&source, "source", "", "Only reparse documents of this source: hltv or cybersport")
+	flagSet.IntVar(&workers, "workers", runtime.NumCPU(), "Number of parallel parse workers")
+	flagSet.BoolVar(&force, "force", false, "Re-parse every document, even if its parsed article is current")
+	flagSet.StringVar(&manifestPath, "manifest", parser.DefaultManifestPath, "Doc id manifest to assign ids of parsed articles in")
+	flagSet.Parse(os.Args[2:])
+
+	if source != "" && source != "hltv" && source != "cybersport" {
+		fmt.Fprintf(os.Stderr, "Error: source must be 'hltv' or 'cybersport'\n")
+		os.Exit(1)
+	}
+
+	db := openStore(configPath)
+	defer db.Close()
+
+	opts := parser.ReparseOptions{Source: source, Workers: workers, Force: force}
+	opts.Listeners = append(opts.Listeners, parser.NewManifestRecorder(manifestPath))
+	var indexer *engine.Indexer
+	if cfg := loadConfig(configPath); cfg.Index.Live {
+		indexer = engine.NewIndexer(cfg.Index.Path, engine.NewEntityMatcher(cfg.Index.Entities))
+		opts.Listeners = append(opts.Listeners, indexer)
+	}
+
+	summary, err := parser.ReparseDocuments(db, opts)
+	warnIndexPending(indexer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	parser.PrintParseSummary(summary)
+}
+
+// warnIndexPending tells when the last live index updates failed, so the
+// index lags behind the store until the next "index" run
+func warnIndexPending(indexer *engine.Indexer) {
+	if indexer == nil {
+		return
+	}
+	if n := indexer.Pending(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d article changes are not in the index, run \"index\" to catch it up\n", n)
+	}
+}
+
+func runExport() {
+	var configPath string
+	var opts export.Options
+	var from, to, changedSince string
+	var topics string
+
+	flagSet := flag.NewFlagSet("export", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.StringVar(&opts.Format, "format", "jsonl", "Output format: "+strings.Join(export.Formats(), ", "))
+	flagSet.StringVar(&opts.Output, "output", "", "Output file, directory for txt, or - for stdout (default: under data/)")
+	flagSet.StringVar(&opts.Source, "source", "", "Only export this source: hltv or cybersport")
+	flagSet.StringVar(&from, "from", "", "Only documents crawled on or after this date (YYYY-MM-DD)")
+	flagSet.StringVar(&to, "to", "", "Only documents crawled before this date (YYYY-MM-DD)")
+	flagSet.StringVar(&changedSince, "changed-since", "", "Only documents whose current version is from this date on (YYYY-MM-DD)")
+	flagSet.IntVar(&opts.Limit, "limit", 0, "Limit number of documents (0 = all)")
+	flagSet.StringVar(&opts.Manifest, "manifest", parser.DefaultManifestPath, "Doc id manifest used by the indexed format")
+	flagSet.StringVar(&topics, "topics", "", "Also convert this query list (one per line) into TREC topics next to the output")
+	flagSet.Parse(os.Args[2:])
+
+	for _, d := range []struct {
+		value string
+		dst   *time.Time
+		name  string
+	}{{from, &opts.From, "from"}, {to, &opts.To, "to"}, {changedSince, &opts.ChangedSince, "changed-since"}} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", d.value, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -%s must be YYYY-MM-DD: %v\n", d.name, err)
+			os.Exit(1)
+		}
+		*d.dst = t
+	}
+
+	if opts.Output == "" {
+		switch opts.Format {
+		case "txt":
+			opts.Output = "data"
+		case "tar":
+			opts.Output = "data/documents.tar.gz"
+		case "trec":
+			opts.Output = "data/documents.trec"
+		case "collection":
+			opts.Output = "data/collection.jsonl"
+		case "indexed":
+			opts.Output = "data/indexed"
+		default:
+			opts.Output = "data/documents." + opts.Format
+		}
+	}
+
+	db := openStore(configPath)
+	defer db.Close()
+
+	start := time.Now()
+	stats, err := export.Run(db, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d documents to %s in %s (%d filtered out, %d failed)\n",
+		stats.Exported, opts.Output, time.Since(start).Round(time.Millisecond), stats.Filtered, stats.Failed)
+	if opts.Format == "trec" || opts.Format == "collection" {
+		fmt.Fprintf(os.Stderr, "Doc id map: %s\n", export.DocMapPath(opts.Output))
+	}
+	if opts.Format == "indexed" {
+		fmt.Fprintf(os.Stderr, "Manifest: %s\n", opts.Manifest)
+	}
+
+	if topics != "" {
+		topicsPath := filepath.Join(filepath.Dir(opts.Output), "topics.txt")
+		n, err := export.WriteTopicsFile(topics, topicsPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write topics: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d topics to %s\n", n, topicsPath)
+	}
+}
+
+func runVersions() {
+	var configPath string
+	var rawURL string
+
+	flagSet := flag.NewFlagSet("versions", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.StringVar(&rawURL, "url", "", "Article URL (required)")
+	flagSet.Parse(os.Args[2:])
+
+	if rawURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: -url is required\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	db := openStore(configPath)
+	defer db.Close()
+
+	doc := loadStoredDocument(db, rawURL)
+	versions := parser.DocumentVersions(doc)
+
+	fmt.Printf("%s (%s)\n\n", doc.URL, doc.Source)
+	fmt.Printf("%-4s %-20s %-34s %s\n", "#", "Fetched", "Hash", "Size")
+	for i, v := range versions {
+		current := ""
+		if v.Hash == doc.HTMLHash && i == len(versions)-1 {
+			current = "  (current)"
+		}
+		fetched := time.Unix(v.FetchedAt, 0).Format("2006-01-02 15:04:05")
+		fmt.Printf("%-4d %-20s %-34s %s%s\n", i+1, fetched, v.Hash, formatBytesStandalone(int64(v.Size)), current)
+	}
+	fmt.Printf("\nLast checked: %s\n", time.Unix(doc.LastChecked, 0).Format("2006-01-02 15:04:05"))
+}
+
+func runDiff() {
+	var configPath string
+	var rawURL string
+	var from, to, context int
+
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.StringVar(&rawURL, "url", "", "Article URL (required)")
+	flagSet.IntVar(&from, "from", 0, "Older version number (default: the one before -to)")
+	flagSet.IntVar(&to, "to", 0, "Newer version number (default: the current version)")
+	flagSet.IntVar(&context, "context", 3, "Unchanged lines shown around each change")
+	flagSet.Parse(os.Args[2:])
+
+	if rawURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: -url is required\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	db := openStore(configPath)
+	defer db.Close()
+
+	doc := loadStoredDocument(db, rawURL)
+	versions := parser.DocumentVersions(doc)
+
+	if to == 0 {
+		to = len(versions)
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || to > len(versions) || from >= to {
+		fmt.Fprintf(os.Stderr, "Error: need 1 <= from < to <= %d (document has %d versions)\n", len(versions), len(versions))
+		os.Exit(1)
+	}
+
+	oldText, err := parser.VersionText(db, doc, versions[from-1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load version %d: %v\n", from, err)
+		os.Exit(1)
+	}
+	newText, err := parser.VersionText(db, doc, versions[to-1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load version %d: %v\n", to, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("--- version %d (%s)\n", from, time.Unix(versions[from-1].FetchedAt, 0).Format("2006-01-02 15:04:05"))
+	fmt.Printf("+++ version %d (%s)\n", to, time.Unix(versions[to-1].FetchedAt, 0).Format("2006-01-02 15:04:05"))
+
+	diff := parser.DiffLines(strings.Split(oldText, "\n"), strings.Split(newText, "\n"))
+	out := parser.FormatDiff(diff, context)
+	if out == "" {
+		fmt.Println("No differences in extracted content")
+		return
+	}
+	fmt.Print(out)
+}
+
+func runIndex() {
+	var configPath string
+	var rebuild, statsOnly bool
+
+	flagSet := flag.NewFlagSet("index", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.BoolVar(&rebuild, "rebuild", false, "Drop the index and build it from scratch")
+	flagSet.BoolVar(&statsOnly, "stats", false, "Only print index statistics")
+	flagSet.Parse(os.Args[2:])
+
+	cfg := loadConfig(configPath)
+
+	// The index only holds derived data, so a rebuild starts from a new file,
+	// whatever format the old one had
+	if rebuild && !statsOnly {
+		if err := os.Remove(cfg.Index.Path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to remove old index: %v\n", err)
+			os.Exit(1)
 		}
 	}
 
-	fmt.Printf("\nParsing completed\n\n")
+	index, err := engine.OpenIndex(cfg.Index.Path, statsOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open index: %v\n", err)
+		os.Exit(1)
+	}
+	defer index.Close()
+	index.Entities = engine.NewEntityMatcher(cfg.Index.Entities)
+
+	if !statsOnly {
+		db := openStore(configPath)
+		defer db.Close()
+
+		start := time.Now()
+		res, err := index.Sync(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Indexing failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Indexed in %s: %d added, %d updated, %d deleted, %d unchanged\n\n",
+			time.Since(start).Round(time.Millisecond), res.Added, res.Updated, res.Deleted, res.Unchanged)
+	}
+
+	stats, err := index.Stats()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read index: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Index Statistics: %s\n", cfg.Index.Path)
+	fmt.Printf("=====================================\n")
+	fmt.Printf("Documents:       %d\n", stats.Docs)
+	fmt.Printf("Field terms:     %d\n", stats.Terms)
+	fmt.Printf("Tokens:          %d\n", stats.TotalLength)
+	if stats.Docs > 0 {
+		fmt.Printf("Avg doc length:  %.1f\n", float64(stats.TotalLength)/float64(stats.Docs))
+	}
+	fmt.Printf("File size:       %s\n", formatBytesStandalone(stats.Size))
+	fmt.Printf("=====================================\n")
+}
+
+func runSearch() {
+	var configPath, manifestPath, style, facetList string
+	var limit, offset, facetLimit int
+	var k1, b float64
+	var explain bool
+
+	flagSet := flag.NewFlagSet("search", flag.ExitOnError)
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.StringVar(&manifestPath, "manifest", parser.DefaultManifestPath, "Doc id manifest to show persistent doc ids from")
+	flagSet.IntVar(&limit, "k", 10, "Number of results")
+	flagSet.IntVar(&offset, "offset", 0, "Skip this many top results")
+	flagSet.Float64Var(&k1, "k1", 0, "BM25 k1 (default: search.bm25.k1 from config)")
+	flagSet.Float64Var(&b, "b", -1, "BM25 b (default: search.bm25.b from config)")
+	flagSet.StringVar(&style, "output", engine.StyleTerminal, "Output style: terminal, html or json")
+	flagSet.BoolVar(&explain, "explain", true, "Show the per-term score breakdown (terminal output)")
+	flagSet.StringVar(&facetList, "facets", "", "Facets to count: source,tag,year,month,entity or all")
+	flagSet.IntVar(&facetLimit, "facet-limit", engine.DefaultFacetLimit, "Values shown per source, tag and entity facet")
+	flagSet.Parse(os.Args[2:])
+
+	query := strings.Join(flagSet.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		fmt.Fprintf(os.Stderr, "Usage: corpus_parser search [flags] <query>\n")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if offset < 0 || limit < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -offset must not be negative and -k must be at least 1\n")
+		os.Exit(1)
+	}
+
+	facets, err := engine.ParseFacetNames(facetList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg := loadConfig(configPath)
+	params := engine.BM25{K1: cfg.Search.BM25.K1, B: cfg.Search.BM25.B}
+	if k1 > 0 {
+		params.K1 = k1
+	}
+	if b >= 0 {
+		params.B = b
+	}
+
+	markers, err := engine.MarkersFor(style, cfg.Search.Snippets.Markers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	index, err := engine.OpenIndex(cfg.Index.Path, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open index: %v\n", err)
+		os.Exit(1)
+	}
+	defer index.Close()
+
+	manifest, err := parser.LoadManifest(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load manifest: %v\n", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	res, err := index.Search(query, engine.SearchOptions{
+		BM25:         params,
+		FieldWeights: cfg.Search.Fields,
+		Offset:       offset,
+		Limit:        limit,
+		Snippets: &engine.SnippetOptions{
+			Passages: cfg.Search.Snippets.Passages,
+			Window:   cfg.Search.Snippets.Window,
+		},
+		Facets:     facets,
+		FacetLimit: facetLimit,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Search failed: %v\n", err)
+		os.Exit(1)
+	}
+	elapsed := time.Since(start)
+	hits := engine.ViewHits(res, offset, manifest, markers, style)
+
+	switch style {
+	case engine.StyleJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(map[string]interface{}{
+			"query":  res.Query,
+			"total":  res.Total,
+			"offset": offset,
+			"hits":   hits,
+			"facets": res.Facets,
+		})
+		return
+	case engine.StyleHTML:
+		fmt.Printf("<ol class=\"results\" start=\"%d\">\n", offset+1)
+		for _, hit := range hits {
+			fmt.Printf("  <li data-ref=\"%s\">\n    <a href=\"%s\">%s</a>\n    <p class=\"snippet\">%s</p>\n  </li>\n",
+				html.EscapeString(hit.Ref), html.EscapeString(hit.URL), hit.Marked, hit.Snippet)
+		}
+		fmt.Printf("</ol>\n")
+		for _, f := range res.Facets {
+			fmt.Printf("<ul class=\"facet\" data-facet=\"%s\">\n", f.Facet)
+			for _, v := range f.Values {
+				fmt.Printf("  <li data-drill=\"%s\">%s (%d)</li>\n",
+					html.EscapeString(v.Drill), html.EscapeString(v.Value), v.Count)
+			}
+			fmt.Printf("</ul>\n")
+		}
+		return
+	}
+
+	fmt.Printf("Query: %s\n", strings.Join(res.Query, " "))
+	fmt.Printf("Found %d documents in %s (BM25 k1=%.2f b=%.2f)\n\n",
+		res.Total, elapsed.Round(time.Microsecond), params.K1, params.B)
+
+	for _, hit := range hits {
+		fmt.Printf("%3d. %7.3f  [%s] %s\n", hit.Rank, hit.Score, hit.Ref, hit.Marked)
+		fmt.Printf("               %s\n", hit.URL)
+		fmt.Printf("               %s\n", hit.Snippet)
+		if explain {
+			for _, t := range hit.Terms {
+				fields := make([]string, len(t.Fields))
+				for i, f := range t.Fields {
+					fields[i] = fmt.Sprintf("%s=%d", f.Field, f.Freq)
+				}
+				fmt.Printf("               %-16s %-22s df=%-5d idf=%.3f tf~=%.3f tf-part=%.3f -> %.3f\n",
+					t.Term, strings.Join(fields, " "), t.DF, t.IDF, t.PseudoFreq, t.Weight, t.Score)
+			}
+		}
+		fmt.Println()
+	}
+
+	for _, f := range res.Facets {
+		fmt.Printf("Facet %s:\n", f.Facet)
+		for _, v := range f.Values {
+			fmt.Printf("  %-24s %5d   %s\n", v.Value, v.Count, engine.DrillTerm(f.Facet, v.Value))
+		}
+		if f.Other > 0 {
+			fmt.Printf("  %-24s %5d\n", "(other)", f.Other)
+		}
+		fmt.Println()
+	}
+}
+
+func runServe() {
+	var addr, configPath, manifestPath string
+
+	flagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	flagSet.StringVar(&addr, "addr", "localhost:8080", "Address to listen on")
+	flagSet.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flagSet.StringVar(&manifestPath, "manifest", parser.DefaultManifestPath, "Doc id manifest to show persistent doc ids from")
+	flagSet.Parse(os.Args[2:])
+
+	cfg := loadConfig(configPath)
+	markers, err := engine.MarkersFor(engine.StyleHTML, cfg.Search.Snippets.Markers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Fail early on a missing or outdated index rather than on every request
+	index, err := engine.OpenIndex(cfg.Index.Path, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open index: %v\n", err)
+		os.Exit(1)
+	}
+	index.Close()
+
+	if _, err := parser.LoadManifest(manifestPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load manifest: %v\n", err)
+		os.Exit(1)
+	}
+
+	server := engine.NewServer(cfg.Index.Path, manifestPath, engine.SearchOptions{
+		BM25:         engine.BM25{K1: cfg.Search.BM25.K1, B: cfg.Search.BM25.B},
+		FieldWeights: cfg.Search.Fields,
+		Snippets: &engine.SnippetOptions{
+			Passages: cfg.Search.Snippets.Passages,
+			Window:   cfg.Search.Snippets.Window,
+		},
+	}, markers)
+
+	fmt.Printf("[serve] Searching %s on http://%s\n", cfg.Index.Path, addr)
+	if err := http.ListenAndServe(addr, server); err != nil {
+		fmt.Fprintf(os.Stderr, "Search server failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runQuery() {
+	var indexPath, manifestPath string
+	var limit int
+
+	flagSet := flag.NewFlagSet("query", flag.ExitOnError)
+	flagSet.StringVar(&indexPath, "index", "index.idx", "BOOLEAN_INDEX file built by index_builder")
+	flagSet.StringVar(&manifestPath, "manifest", parser.DefaultManifestPath, "Doc id manifest the index was built from")
+	flagSet.IntVar(&limit, "limit", 20, "Max results to print (0 = all)")
+	flagSet.Parse(os.Args[2:])
+
+	query := strings.Join(flagSet.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		fmt.Fprintf(os.Stderr, "Usage: corpus_parser query [flags] <query>\n")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	e, err := engine.OpenBooleanEngine(indexPath, manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load index: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Loaded %d terms over %d documents in %s\n",
+		e.Index.TermCount(), e.Index.DocCount, time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+	hits, err := e.Search(query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad query: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Found %d documents in %s\n\n", len(hits), time.Since(start).Round(time.Microsecond))
+	for i, hit := range hits {
+		if limit > 0 && i == limit {
+			fmt.Printf("... and %d more\n", len(hits)-limit)
+			break
+		}
+		if hit.URL == "" {
+			fmt.Printf("%8d  (not in manifest)\n", hit.ID)
+			continue
+		}
+		fmt.Printf("%8d  %s\n          %s\n", hit.ID, hit.Title, hit.URL)
+	}
 }
 
 func runStats() {
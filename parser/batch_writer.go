@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DocumentWrite is one pending store write. A write without RawHTML only
+// marks the document as checked now.
+type DocumentWrite struct {
+	URL     string
+	RawHTML string
+	Source  string
+}
+
+// ParsedListener is told about parsed articles once the store has them, so
+// derived data such as the search index can follow the crawl
+type ParsedListener interface {
+	// ParsedChanged gets the records just written and the URLs whose parsed
+	// article was dropped
+	ParsedChanged(records []*ParsedRecord, removed []string)
+}
+
+// BatchWriter buffers document writes and hands them to the store in
+// batches, when the buffer is full or FlushEvery has passed. Later writes to
+// the same URL replace earlier buffered ones, for documents and parsed
+// articles alike. A batch the store rejects is queued again for the next
+// flush, together with its parsed articles.
+type BatchWriter struct {
+	store      DocumentStore
+	batchSize  int
+	flushEvery time.Duration
+
+	mu      sync.Mutex
+	pending []DocumentWrite
+	index   map[string]int
+	// articles holds one save or drop of a parsed article per URL
+	articles     []articleOp
+	articleIndex map[string]int
+	written      int
+	failed       int
+	// retryAt holds off flushes on a full buffer after a failed one; the
+	// timer and Close still retry
+	retryAt time.Time
+
+	listeners []ParsedListener
+
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// articleOp saves record, or drops the parsed article of url when record is
+// nil
+type articleOp struct {
+	url    string
+	record *ParsedRecord
+}
+
+func NewBatchWriter(store DocumentStore, batchSize int, flushEvery time.Duration) *BatchWriter {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	w := &BatchWriter{
+		store:      store,
+		batchSize:  batchSize,
+		flushEvery: flushEvery,
+		index:      make(map[string]int),
+
+		articleIndex: make(map[string]int),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+func (w *BatchWriter) loop() {
+	defer close(w.done)
+	if w.flushEvery <= 0 {
+		<-w.stop
+		return
+	}
+
+	ticker := time.NewTicker(w.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Save queues rawHTML as the current version of the document
+func (w *BatchWriter) Save(normalizedURL, rawHTML, source string) {
+	w.add(DocumentWrite{URL: normalizedURL, RawHTML: rawHTML, Source: source})
+}
+
+// Touch queues a last_checked update for an unchanged document
+func (w *BatchWriter) Touch(normalizedURL string) {
+	w.add(DocumentWrite{URL: normalizedURL})
+}
+
+// SaveParsed queues an extracted article. It is written after the documents
+// of the same batch and replaces a queued drop of the URL.
+func (w *BatchWriter) SaveParsed(record *ParsedRecord) {
+	w.addArticle(articleOp{url: record.URL, record: record})
+}
+
+// DropParsed queues removal of the parsed article of a document that no
+// longer extracts. It replaces a queued save of the URL.
+func (w *BatchWriter) DropParsed(normalizedURL string) {
+	w.addArticle(articleOp{url: normalizedURL})
+}
+
+func (w *BatchWriter) addArticle(op articleOp) {
+	w.mu.Lock()
+	if i, ok := w.articleIndex[op.url]; ok {
+		w.articles[i] = op
+	} else {
+		w.articleIndex[op.url] = len(w.articles)
+		w.articles = append(w.articles, op)
+	}
+	full := len(w.articles) >= w.batchSize && time.Now().After(w.retryAt)
+	w.mu.Unlock()
+
+	if full {
+		w.Flush()
+	}
+}
+
+// AddListener registers l for every parsed batch written from now on
+func (w *BatchWriter) AddListener(l ParsedListener) {
+	w.mu.Lock()
+	w.listeners = append(w.listeners, l)
+	w.mu.Unlock()
+}
+
+func (w *BatchWriter) add(write DocumentWrite) {
+	w.mu.Lock()
+	if i, ok := w.index[write.URL]; ok {
+		// A touch never replaces a queued save
+		if write.RawHTML != "" || w.pending[i].RawHTML == "" {
+			w.pending[i] = write
+		}
+	} else {
+		w.index[write.URL] = len(w.pending)
+		w.pending = append(w.pending, write)
+	}
+	full := len(w.pending) >= w.batchSize && time.Now().After(w.retryAt)
+	w.mu.Unlock()
+
+	if full {
+		w.Flush()
+	}
+}
+
+// Flush writes everything buffered so far
+func (w *BatchWriter) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	articles := w.articles
+	listeners := w.listeners
+	w.pending = nil
+	w.articles = nil
+	w.index = make(map[string]int)
+	w.articleIndex = make(map[string]int)
+	w.mu.Unlock()
+
+	if len(batch) == 0 && len(articles) == 0 {
+		return nil
+	}
+
+	if len(batch) > 0 {
+		if err := w.store.WriteDocuments(batch); err != nil {
+			fmt.Printf("[batch] Failed to write %d documents, will retry: %v\n", len(batch), err)
+			w.requeue(batch, articles)
+			return err
+		}
+		w.mu.Lock()
+		w.written += len(batch)
+		w.mu.Unlock()
+	}
+
+	// One op per URL, so saves and drops never touch the same article and
+	// their order does not matter
+	var parsed []*ParsedRecord
+	var dropped []string
+	var drops []articleOp
+	for _, op := range articles {
+		if op.record != nil {
+			parsed = append(parsed, op.record)
+		} else {
+			dropped = append(dropped, op.url)
+			drops = append(drops, op)
+		}
+	}
+
+	if err := w.store.SaveParsed(parsed); err != nil {
+		fmt.Printf("[batch] Failed to write %d parsed articles, will retry: %v\n", len(parsed), err)
+		w.requeue(nil, articles)
+		return err
+	}
+	if err := w.store.DeleteParsed(dropped); err != nil {
+		fmt.Printf("[batch] Failed to drop %d parsed articles, will retry: %v\n", len(dropped), err)
+		w.requeue(nil, drops)
+		if len(parsed) > 0 {
+			for _, l := range listeners {
+				l.ParsedChanged(parsed, nil)
+			}
+		}
+		return err
+	}
+
+	if len(parsed) > 0 || len(dropped) > 0 {
+		for _, l := range listeners {
+			l.ParsedChanged(parsed, dropped)
+		}
+	}
+	return nil
+}
+
+// requeue puts the writes of a failed flush back in front of those queued
+// since. A document or article written again meanwhile keeps its newer
+// write.
+func (w *BatchWriter) requeue(batch []DocumentWrite, articles []articleOp) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pending := make([]DocumentWrite, 0, len(batch)+len(w.pending))
+	for _, write := range batch {
+		if i, ok := w.index[write.URL]; ok {
+			// A touch never replaces a failed save
+			if w.pending[i].RawHTML == "" && write.RawHTML != "" {
+				w.pending[i] = write
+			}
+			continue
+		}
+		pending = append(pending, write)
+	}
+	w.pending = append(pending, w.pending...)
+	w.index = make(map[string]int, len(w.pending))
+	for i, write := range w.pending {
+		w.index[write.URL] = i
+	}
+
+	ops := make([]articleOp, 0, len(articles)+len(w.articles))
+	for _, op := range articles {
+		if _, ok := w.articleIndex[op.url]; !ok {
+			ops = append(ops, op)
+		}
+	}
+	w.articles = append(ops, w.articles...)
+	w.articleIndex = make(map[string]int, len(w.articles))
+	for i, op := range w.articles {
+		w.articleIndex[op.url] = i
+	}
+	w.retryAt = time.Now().Add(5 * time.Second)
+}
+
+// Close stops the flush timer and writes what is left. If the store still
+// fails, the documents that never made it count as failed.
+func (w *BatchWriter) Close() error {
+	close(w.stop)
+	<-w.done
+	err := w.Flush()
+	if err != nil {
+		w.mu.Lock()
+		w.failed += len(w.pending)
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// Counts returns how many writes succeeded and failed so far
+func (w *BatchWriter) Counts() (written, failed int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written, w.failed
+}
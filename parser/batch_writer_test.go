@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// flakyStore fails the next WriteDocuments call when down is set
+type flakyStore struct {
+	DocumentStore
+	down bool
+}
+
+func (s *flakyStore) WriteDocuments(writes []DocumentWrite) error {
+	if s.down {
+		s.down = false
+		return errors.New("store unavailable")
+	}
+	return s.DocumentStore.WriteDocuments(writes)
+}
+
+func TestBatchWriterRequeuesFailedBatch(t *testing.T) {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "docs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+	store := &flakyStore{DocumentStore: bolt, down: true}
+
+	w := NewBatchWriter(store, 100, 0)
+	w.Save("https://example.com/a", "<p>a</p>", "hltv")
+	w.SaveParsed(&ParsedRecord{URL: "https://example.com/a", Source: "hltv", Title: "A"})
+	w.DropParsed("https://example.com/b")
+	if err := w.Flush(); err == nil {
+		t.Fatal("flush against a failing store returned no error")
+	}
+
+	// Queued while the store was down; a newer save of a wins over the
+	// failed one and a later touch does not replace it
+	w.Save("https://example.com/a", "<p>a2</p>", "hltv")
+	w.Touch("https://example.com/a")
+	w.Save("https://example.com/c", "<p>c</p>", "hltv")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := bolt.GetDocument("https://example.com/a")
+	if err != nil || doc == nil {
+		t.Fatalf("document a not written: %v", err)
+	}
+	if doc.RawHTML != "<p>a2</p>" {
+		t.Errorf("document a has %q, want the newer save", doc.RawHTML)
+	}
+	if doc, _ := bolt.GetDocument("https://example.com/c"); doc == nil {
+		t.Error("document c not written")
+	}
+	if rec, _ := bolt.GetParsed("https://example.com/a"); rec == nil || rec.Title != "A" {
+		t.Errorf("parsed article of the failed batch lost: %+v", rec)
+	}
+	if written, failed := w.Counts(); written != 2 || failed != 0 {
+		t.Errorf("counts written=%d failed=%d, want 2 and 0", written, failed)
+	}
+}
+
+// A changed page that no longer extracts loses its parsed article, whether
+// the crawl writes directly or through the batch writer
+func TestParseCrawledPageDropsStaleArticle(t *testing.T) {
+	const url = "https://www.hltv.org/news/1/gone"
+	for _, batched := range []bool{false, true} {
+		store, err := NewBoltStore(filepath.Join(t.TempDir(), "docs.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveParsed([]*ParsedRecord{{URL: url, Source: "hltv", Title: "Old"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		var writer *BatchWriter
+		if batched {
+			writer = NewBatchWriter(store, 100, 0)
+		}
+		parseCrawledPage(store, writer, url, "<html><body>removed</body></html>", "hltv", "test", "1")
+		if writer != nil {
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if rec, err := store.GetParsed(url); err != nil || rec != nil {
+			t.Errorf("batched=%v: stale article kept: %+v, %v", batched, rec, err)
+		}
+		store.Close()
+	}
+}
+
+type recordingListener struct {
+	records []string
+	removed []string
+}
+
+func (l *recordingListener) ParsedChanged(records []*ParsedRecord, removed []string) {
+	for _, r := range records {
+		l.records = append(l.records, r.URL)
+	}
+	l.removed = append(l.removed, removed...)
+}
+
+// The last save or drop of an article within a flush wins, also across a
+// failed flush, and listeners hear about each URL once
+func TestBatchWriterLastArticleOpWins(t *testing.T) {
+	const a, b, c = "https://example.com/a", "https://example.com/b", "https://example.com/c"
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "docs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+	if err := bolt.SaveParsed([]*ParsedRecord{{URL: a, Title: "A0"}, {URL: b, Title: "B0"}}); err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyStore{DocumentStore: bolt}
+
+	w := NewBatchWriter(store, 100, 0)
+	l := &recordingListener{}
+	w.AddListener(l)
+
+	w.DropParsed(a)
+	w.SaveParsed(&ParsedRecord{URL: a, Title: "A1"})
+	w.SaveParsed(&ParsedRecord{URL: b, Title: "B1"})
+	w.DropParsed(b)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := bolt.GetParsed(a); rec == nil || rec.Title != "A1" {
+		t.Errorf("save after drop: got %+v, want A1", rec)
+	}
+	if rec, _ := bolt.GetParsed(b); rec != nil {
+		t.Errorf("drop after save: %+v kept", rec)
+	}
+	if !reflect.DeepEqual(l.records, []string{a}) || !reflect.DeepEqual(l.removed, []string{b}) {
+		t.Errorf("listener got records %v removed %v, want [%s] and [%s]", l.records, l.removed, a, b)
+	}
+
+	// A drop requeued by a failed flush must not undo a save queued since
+	store.down = true
+	w.Save(c, "<p>c</p>", "hltv")
+	w.DropParsed(a)
+	if err := w.Flush(); err == nil {
+		t.Fatal("flush against a failing store returned no error")
+	}
+	w.SaveParsed(&ParsedRecord{URL: a, Title: "A2"})
+	l.records, l.removed = nil, nil
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := bolt.GetParsed(a); rec == nil || rec.Title != "A2" {
+		t.Errorf("save queued after a failed drop: got %+v, want A2", rec)
+	}
+	if !reflect.DeepEqual(l.records, []string{a}) || len(l.removed) != 0 {
+		t.Errorf("listener got records %v removed %v, want [%s] only", l.records, l.removed, a)
+	}
+}
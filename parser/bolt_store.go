@@ -0,0 +1,341 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	documentsBucket = []byte("documents")
+	rawBucket       = []byte("raw")
+	parsedBucket    = []byte("parsed")
+)
+
+// BoltStore is the embedded DocumentStore: a single bbolt file with one JSON
+// value per normalized URL. It needs no server, which suits laptops and CI.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(documentsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(rawBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(parsedBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) SaveDocument(normalizedURL, rawHTML, source string) error {
+	return s.WriteDocuments([]DocumentWrite{{URL: normalizedURL, RawHTML: rawHTML, Source: source}})
+}
+
+// WriteDocuments applies the whole batch in one transaction
+func (s *BoltStore) WriteDocuments(writes []DocumentWrite) error {
+	now := time.Now().Unix()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(documentsBucket)
+		raw := tx.Bucket(rawBucket)
+
+		for _, w := range writes {
+			var prev *Document
+			if data := bucket.Get([]byte(w.URL)); data != nil {
+				prev = &Document{}
+				if err := json.Unmarshal(data, prev); err != nil {
+					return err
+				}
+			}
+
+			if w.RawHTML == "" {
+				if prev == nil {
+					continue
+				}
+				prev.LastChecked = now
+				if err := putDocument(bucket, prev); err != nil {
+					return err
+				}
+				continue
+			}
+
+			htmlHash := computeHTMLHash(w.RawHTML)
+			versions, seed, added := appendVersion(prev, w.RawHTML, htmlHash, now)
+			if seed != nil {
+				if err := raw.Put([]byte(seed.Hash), []byte(prev.RawHTML)); err != nil {
+					return err
+				}
+			}
+			if added {
+				if err := raw.Put([]byte(htmlHash), []byte(w.RawHTML)); err != nil {
+					return err
+				}
+			}
+
+			err := putDocument(bucket, &Document{
+				URL:         w.URL,
+				RawHTML:     w.RawHTML,
+				Source:      w.Source,
+				CrawlTime:   now,
+				HTMLHash:    htmlHash,
+				LastChecked: now,
+				Versions:    versions,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetDocumentHashes(normalizedURLs []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(normalizedURLs))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(documentsBucket)
+		for _, u := range normalizedURLs {
+			data := bucket.Get([]byte(u))
+			if data == nil {
+				continue
+			}
+			var doc struct {
+				HTMLHash string `json:"html_hash"`
+			}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				return err
+			}
+			hashes[u] = doc.HTMLHash
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+func (s *BoltStore) GetRawVersion(rawRef string) (string, error) {
+	var html string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		html = string(tx.Bucket(rawBucket).Get([]byte(rawRef)))
+		return nil
+	})
+	return html, err
+}
+
+func (s *BoltStore) DocumentExists(normalizedURL string) (bool, error) {
+	exists := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(documentsBucket).Get([]byte(normalizedURL)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+func (s *BoltStore) GetDocument(normalizedURL string) (*Document, error) {
+	var doc *Document
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(documentsBucket).Get([]byte(normalizedURL))
+		if data == nil {
+			return nil
+		}
+		doc = &Document{}
+		return json.Unmarshal(data, doc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *BoltStore) HasDocumentChanged(normalizedURL, newHTML string) (bool, error) {
+	return documentChanged(s, normalizedURL, newHTML)
+}
+
+func (s *BoltStore) GetDocumentsForReCrawl(reCrawlInterval int) ([]Document, error) {
+	if reCrawlInterval <= 0 {
+		return nil, nil
+	}
+
+	cutoffTime := time.Now().Unix() - int64(reCrawlInterval)
+	var docs []Document
+	err := s.ForEach(func(doc *Document) error {
+		if doc.LastChecked < cutoffTime {
+			docs = append(docs, *doc)
+		}
+		return nil
+	})
+	return docs, err
+}
+
+func (s *BoltStore) UpdateLastChecked(normalizedURL string) error {
+	return s.WriteDocuments([]DocumentWrite{{URL: normalizedURL}})
+}
+
+func (s *BoltStore) GetLastProcessedURL() (string, error) {
+	var last Document
+	err := s.ForEach(func(doc *Document) error {
+		if doc.CrawlTime > last.CrawlTime {
+			last = *doc
+		}
+		return nil
+	})
+	return last.URL, err
+}
+
+// ForEach reads the documents in pages of boltPageSize and calls fn outside
+// of any transaction, so fn may write to the store
+func (s *BoltStore) ForEach(fn func(*Document) error) error {
+	return s.forEachPage(documentsBucket, func(data []byte) error {
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		return fn(&doc)
+	})
+}
+
+// ForEachMatching checks the filter on the source and crawl time alone and
+// decodes the full document only when it passes
+func (s *BoltStore) ForEachMatching(filter DocumentFilter, fn func(*Document) error) error {
+	return s.forEachPage(documentsBucket, func(data []byte) error {
+		var head struct {
+			Source    string `json:"source"`
+			CrawlTime int64  `json:"crawl_time"`
+		}
+		if err := json.Unmarshal(data, &head); err != nil {
+			return err
+		}
+		if !filter.Matches(head.Source, head.CrawlTime) {
+			return nil
+		}
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		return fn(&doc)
+	})
+}
+
+func (s *BoltStore) SaveParsed(records []*ParsedRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(parsedBucket)
+		for _, r := range records {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(r.URL), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) DeleteParsed(normalizedURLs []string) error {
+	if len(normalizedURLs) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(parsedBucket)
+		for _, u := range normalizedURLs {
+			if err := bucket.Delete([]byte(u)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetParsed(normalizedURL string) (*ParsedRecord, error) {
+	var record *ParsedRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(parsedBucket).Get([]byte(normalizedURL))
+		if data == nil {
+			return nil
+		}
+		record = &ParsedRecord{}
+		return json.Unmarshal(data, record)
+	})
+	return record, err
+}
+
+func (s *BoltStore) ForEachParsed(fn func(*ParsedRecord) error) error {
+	return s.forEachPage(parsedBucket, func(data []byte) error {
+		var record ParsedRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		return fn(&record)
+	})
+}
+
+const boltPageSize = 256
+
+func (s *BoltStore) forEachPage(bucketName []byte, fn func(data []byte) error) error {
+	var after []byte
+	for {
+		var page [][]byte
+		err := s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(bucketName).Cursor()
+			k, v := c.First()
+			if after != nil {
+				k, v = c.Seek(after)
+				if k != nil && string(k) == string(after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(page) < boltPageSize; k, v = c.Next() {
+				page = append(page, append([]byte(nil), v...))
+				after = append(after[:0:0], k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, data := range page {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		if len(page) < boltPageSize {
+			return nil
+		}
+	}
+}
+
+func putDocument(bucket *bolt.Bucket, doc *Document) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(doc.URL), data)
+}
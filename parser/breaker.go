@@ -0,0 +1,227 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerConfig struct {
+	Window    int     `yaml:"window"`
+	Threshold float64 `yaml:"threshold"`
+	Cooldown  int     `yaml:"cooldown"`
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type BreakerTransition struct {
+	Time   string `json:"time"`
+	Domain string `json:"domain"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// CircuitBreaker stops dispatch to a domain once too many of its recent
+// responses were anti-bot walls. After the cooldown a single probe request is
+// let through; the breaker closes if it succeeds and reopens otherwise.
+type CircuitBreaker struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	set    *BreakerSet
+	domain string
+
+	state    BreakerState
+	outcomes []bool
+	next     int
+	filled   int
+	openedAt time.Time
+	probing  bool
+}
+
+type BreakerSet struct {
+	mu          sync.Mutex
+	cfg         BreakerConfig
+	breakers    map[string]*CircuitBreaker
+	transitions []BreakerTransition
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:    20,
+		Threshold: 0.5,
+		Cooldown:  120,
+	}
+}
+
+func NewBreakerSet(cfg BreakerConfig) *BreakerSet {
+	def := DefaultBreakerConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = def.Window
+	}
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		cfg.Threshold = def.Threshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = def.Cooldown
+	}
+
+	return &BreakerSet{
+		cfg:      cfg,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Domain returns the breaker for a domain, creating it on first use
+func (s *BreakerSet) Domain(domain string) *CircuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[domain]
+	if !ok {
+		b = &CircuitBreaker{
+			set:      s,
+			domain:   domain,
+			outcomes: make([]bool, s.cfg.Window),
+		}
+		b.cond = sync.NewCond(&b.mu)
+		s.breakers[domain] = b
+	}
+	return b
+}
+
+// Transitions returns every state change recorded so far
+func (s *BreakerSet) Transitions() []BreakerTransition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]BreakerTransition, len(s.transitions))
+	copy(res, s.transitions)
+	return res
+}
+
+func (s *BreakerSet) record(t BreakerTransition) {
+	s.mu.Lock()
+	s.transitions = append(s.transitions, t)
+	s.mu.Unlock()
+
+	fmt.Printf("[breaker] %s: %s -> %s (%s)\n", t.Domain, t.From, t.To, t.Reason)
+}
+
+// Wait blocks while the breaker is open. When the cooldown has passed the
+// first caller becomes the probe and returns; others keep waiting for its
+// result.
+func (b *CircuitBreaker) Wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cooldown := time.Duration(b.set.cfg.Cooldown) * time.Second
+	for {
+		switch b.state {
+		case BreakerClosed:
+			return
+		case BreakerOpen:
+			remaining := cooldown - time.Since(b.openedAt)
+			if remaining <= 0 {
+				b.transition(BreakerHalfOpen, "cooldown elapsed, probing")
+				b.probing = true
+				return
+			}
+			b.mu.Unlock()
+			time.Sleep(remaining)
+			b.mu.Lock()
+		case BreakerHalfOpen:
+			if !b.probing {
+				b.probing = true
+				return
+			}
+			b.cond.Wait()
+		}
+	}
+}
+
+// Record feeds the outcome of a request released by Wait back into the
+// breaker. failed marks responses that should count against the domain
+// besides walls, e.g. network errors during a probe.
+func (b *CircuitBreaker) Record(blocked bool, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if blocked || failed {
+			b.open("probe failed")
+		} else {
+			b.reset()
+			b.transition(BreakerClosed, "probe succeeded")
+		}
+		b.cond.Broadcast()
+		return
+	}
+
+	if b.state != BreakerClosed || failed {
+		return
+	}
+
+	b.outcomes[b.next] = blocked
+	b.next = (b.next + 1) % len(b.outcomes)
+	if b.filled < len(b.outcomes) {
+		b.filled++
+	}
+	if b.filled < len(b.outcomes) {
+		return
+	}
+
+	count := 0
+	for _, o := range b.outcomes {
+		if o {
+			count++
+		}
+	}
+	rate := float64(count) / float64(len(b.outcomes))
+	if rate >= b.set.cfg.Threshold {
+		b.open(fmt.Sprintf("%d of last %d responses blocked", count, len(b.outcomes)))
+	}
+}
+
+func (b *CircuitBreaker) open(reason string) {
+	b.openedAt = time.Now()
+	b.transition(BreakerOpen, reason)
+}
+
+func (b *CircuitBreaker) reset() {
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+	b.next = 0
+	b.filled = 0
+}
+
+func (b *CircuitBreaker) transition(to BreakerState, reason string) {
+	from := b.state
+	b.state = to
+	b.set.record(BreakerTransition{
+		Time:   time.Now().Format(time.RFC3339),
+		Domain: b.domain,
+		From:   from.String(),
+		To:     to.String(),
+		Reason: reason,
+	})
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBreakerOpensOnForbidden(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	oldThrottle, oldBreakers := Throttle, Breakers
+	defer func() { Throttle, Breakers = oldThrottle, oldBreakers }()
+	Throttle = NewThrottleController(ThrottleConfig{InitialRate: 1000, MaxRate: 1000})
+	Breakers = NewBreakerSet(BreakerConfig{Window: 4, Threshold: 0.5, Cooldown: 60})
+
+	for i := 0; i < 4; i++ {
+		if _, err := FetchURLHTML(srv.URL + "/news/1"); !IsBlockedStatus(err) {
+			t.Fatalf("request %d: got %v, want a 403 error", i+1, err)
+		}
+	}
+
+	transitions := Breakers.Transitions()
+	if len(transitions) != 1 || transitions[0].To != "open" {
+		t.Fatalf("transitions = %+v, want one to open", transitions)
+	}
+}
+
+func TestBreakerIgnoresNetworkErrorsWhileClosed(t *testing.T) {
+	breakers := NewBreakerSet(BreakerConfig{Window: 2, Threshold: 0.5, Cooldown: 60})
+	b := breakers.Domain("example.com")
+	for i := 0; i < 4; i++ {
+		b.Record(false, true)
+	}
+	if len(breakers.Transitions()) != 0 {
+		t.Fatalf("breaker changed state on network errors: %+v", breakers.Transitions())
+	}
+}
@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+var ErrCassetteMiss = errors.New("not found in cassette")
+
+type CassetteConfig struct {
+	Mode string `yaml:"mode"`
+	Dir  string `yaml:"dir"`
+}
+
+// CassetteEntry is one recorded request/response pair. Body holds the bytes
+// as they came over the wire, still compressed if Content-Encoding says so;
+// JSON stores them base64 encoded.
+type CassetteEntry struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Status     int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Via        string      `json:"via"`
+	RecordedAt string      `json:"recorded_at"`
+}
+
+type CassetteStats struct {
+	Mode     string `json:"mode"`
+	Dir      string `json:"dir"`
+	Recorded int64  `json:"recorded"`
+	Hits     int64  `json:"hits"`
+	Misses   int64  `json:"misses"`
+}
+
+// Cassette stores fetched pages on disk (record mode) and serves fetches
+// only from there (replay mode), so discovery, downloads and parsing can be
+// rerun deterministically without the live sites
+type Cassette struct {
+	Dir  string
+	Mode string
+
+	recorded int64
+	hits     int64
+	misses   int64
+}
+
+func OpenCassette(dir, mode string) (*Cassette, error) {
+	if mode != CassetteRecord && mode != CassetteReplay {
+		return nil, fmt.Errorf("unknown cassette mode: %s", mode)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("cassette directory is required")
+	}
+
+	if mode == CassetteRecord {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+
+	return &Cassette{Dir: dir, Mode: mode}, nil
+}
+
+// UseCassette makes the fetch layer record to or replay from c
+func UseCassette(c *Cassette) {
+	ActiveCassette = c
+	if c.Mode == CassetteRecord {
+		HTTPClient.Transport = &cassetteTransport{cassette: c, next: HTTPClient.Transport}
+	}
+}
+
+// Replaying reports whether fetches must be served from the cassette only
+func Replaying() bool {
+	return ActiveCassette != nil && ActiveCassette.Mode == CassetteReplay
+}
+
+func (c *Cassette) path(method, url string) string {
+	if normalized, err := NormalizeURL(url); err == nil {
+		url = normalized
+	}
+	sum := sha1.Sum([]byte(method + " " + url))
+	return filepath.Join(c.Dir, fmt.Sprintf("%x.json", sum))
+}
+
+func (c *Cassette) Load(method, url string) (*CassetteEntry, error) {
+	data, err := os.ReadFile(c.path(method, url))
+	if os.IsNotExist(err) {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, fmt.Errorf("%s %s: %w", method, url, ErrCassetteMiss)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry CassetteEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette entry for %s: %w", url, err)
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return &entry, nil
+}
+
+// Save stores an entry. A successful response is never overwritten by a
+// failed one, so retries after a 429 keep the page that finally loaded.
+func (c *Cassette) Save(entry *CassetteEntry) error {
+	p := c.path(entry.Method, entry.URL)
+
+	if entry.Status != http.StatusOK {
+		if data, err := os.ReadFile(p); err == nil {
+			var prev CassetteEntry
+			if json.Unmarshal(data, &prev) == nil && prev.Status == http.StatusOK {
+				return nil
+			}
+		}
+	}
+
+	if entry.RecordedAt == "" {
+		entry.RecordedAt = time.Now().Format(time.RFC3339)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.recorded, 1)
+	return nil
+}
+
+// RecordHTML stores a page that was not fetched over HTTP, e.g. by the browser
+func (c *Cassette) RecordHTML(url, html, via string) {
+	entry := &CassetteEntry{
+		Method: http.MethodGet,
+		URL:    url,
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:   []byte(html),
+		Via:    via,
+	}
+	if err := c.Save(entry); err != nil {
+		fmt.Printf("[cassette] Failed to record %s: %v\n", url, err)
+	}
+}
+
+// FetchPage serves a page from the cassette the same way HTTPFetchPage
+// would have returned it
+func (c *Cassette) FetchPage(url string) (*goquery.Document, error) {
+	entry, err := c.Load(http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status != http.StatusOK {
+		return nil, &HTTPStatusError{URL: url, StatusCode: entry.Status}
+	}
+	body, err := decodeBody(entry.Header.Get("Content-Encoding"), bytes.NewReader(entry.Body))
+	if err != nil {
+		return nil, fmt.Errorf("cassette entry for %s: %w", url, err)
+	}
+	return goquery.NewDocumentFromReader(body)
+}
+
+func (c *Cassette) Stats() CassetteStats {
+	return CassetteStats{
+		Mode:     c.Mode,
+		Dir:      c.Dir,
+		Recorded: atomic.LoadInt64(&c.recorded),
+		Hits:     atomic.LoadInt64(&c.hits),
+		Misses:   atomic.LoadInt64(&c.misses),
+	}
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &CassetteEntry{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+		Body:   body,
+		Via:    "http",
+	}
+	if err := t.cassette.Save(entry); err != nil {
+		fmt.Printf("[cassette] Failed to record %s: %v\n", req.URL, err)
+	}
+
+	return resp, nil
+}
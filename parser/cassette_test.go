@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gzipHandler compresses every response for clients that accept gzip, the
+// way the live sites do
+type gzipHandler struct{ next http.Handler }
+
+type gzipWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w gzipWriter) Write(p []byte) (int, error) { return w.gz.Write(p) }
+
+func (h gzipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	h.next.ServeHTTP(gzipWriter{ResponseWriter: w, gz: gz}, r)
+}
+
+// TestCassetteRecordReplay records discovery, download and parsing of a
+// mirrored HLTV article, then replays all three with the server gone
+func TestCassetteRecordReplay(t *testing.T) {
+	corpus := t.TempDir()
+	rawDir := filepath.Join(corpus, "hltv", "raw")
+	if err := os.MkdirAll(rawDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := os.ReadFile(filepath.Join("testdata", "golden", "hltv", "38123.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rawDir, "38123.html"), fixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mirror, err := NewMirror(corpus, []string{"hltv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gzipHandler{next: mirror})
+
+	oldBase, oldStart, oldDelay := HLTVBaseURL, HLTVArchiveStart, ArchivePageDelay
+	oldTransport, oldCassette, oldThrottle := HTTPClient.Transport, ActiveCassette, Throttle
+	defer func() {
+		HLTVBaseURL, HLTVArchiveStart, ArchivePageDelay = oldBase, oldStart, oldDelay
+		HTTPClient.Transport, ActiveCassette, Throttle = oldTransport, oldCassette, oldThrottle
+	}()
+	HLTVBaseURL = srv.URL
+	// The mirror files the article under its publication month, July 2024
+	HLTVArchiveStart = 2024
+	ArchivePageDelay = 0
+	Throttle = NewThrottleController(ThrottleConfig{InitialRate: 1000, MaxRate: 1000})
+
+	dir := t.TempDir()
+	run := func() ([]map[string]string, string, *Article) {
+		t.Helper()
+		articles, err := GetHLTVNewsIDs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(articles) != 1 {
+			t.Fatalf("discovered %v, want one article", articles)
+		}
+		html, err := FetchURLHTML(BuildHLTVURL(articles[0]["id"], articles[0]["slug"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		article, err := ParseArticleFromHTML("hltv", html, BuildHLTVURL(articles[0]["id"], articles[0]["slug"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return articles, html, article
+	}
+
+	recorder, err := OpenCassette(dir, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseCassette(recorder)
+	recArticles, recHTML, recArticle := run()
+	srv.Close()
+	HTTPClient.Transport = oldTransport
+
+	if recArticle.Title != "Vitality win IEM Cologne after five-map final" {
+		t.Fatalf("recorded title = %q", recArticle.Title)
+	}
+	entry, err := recorder.Load(http.MethodGet, BuildHLTVURL(recArticles[0]["id"], recArticles[0]["slug"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("recorded page is not compressed (Content-Encoding %q)", entry.Header.Get("Content-Encoding"))
+	}
+
+	player, err := OpenCassette(dir, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseCassette(player)
+	articles, html, article := run()
+
+	if !reflect.DeepEqual(articles, recArticles) {
+		t.Errorf("replayed discovery %v, recorded %v", articles, recArticles)
+	}
+	if html != recHTML {
+		t.Errorf("replayed page differs from the recorded one")
+	}
+	if !reflect.DeepEqual(article, recArticle) {
+		t.Errorf("replayed article %+v, recorded %+v", article, recArticle)
+	}
+	if stats := player.Stats(); stats.Misses != 0 {
+		t.Errorf("replay missed %d requests", stats.Misses)
+	}
+}
+
+func TestCassetteKeepsBodyBytes(t *testing.T) {
+	c, err := OpenCassette(t.TempDir(), CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// windows-1251 text and gzip data are not valid UTF-8
+	for _, body := range [][]byte{
+		[]byte("<p>\xcf\xf0\xe8\xe2\xe5\xf2</p>"),
+		{0x1f, 0x8b, 0x08, 0x00, 0xff, 0xfe},
+	} {
+		entry := &CassetteEntry{Method: http.MethodGet, URL: "https://example.com/page", Status: http.StatusOK, Body: body}
+		if err := c.Save(entry); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Load(http.MethodGet, "https://example.com/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Body, body) {
+			t.Errorf("body % x came back as % x", body, got.Body)
+		}
+	}
+}
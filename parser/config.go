@@ -15,6 +15,14 @@ type Article struct {
 	Content string
 	Source  string
 	Tag     string
+
+	// Lead and Paragraphs are the parts Content is made of
+	Lead       string
+	Paragraphs []string
+	Metadata   ArticleMetadata
+
+	// Extractor is the strategy that produced Content: selectors or readability
+	Extractor string
 }
 
 type Statistics struct {
@@ -25,16 +33,29 @@ type Statistics struct {
 	DownloadTime       string `json:"download_time"`
 	CorpusPath         string `json:"corpus_path"`
 	BrowserMode        bool   `json:"browser_mode"`
+	HybridMode         bool   `json:"hybrid_mode"`
+
+	FetchPaths FetchPathStats `json:"fetch_paths"`
+
+	Throttle           []ThrottleStats     `json:"throttle,omitempty"`
+	BreakerTransitions []BreakerTransition `json:"breaker_transitions,omitempty"`
+	Cassette           *CassetteStats      `json:"cassette,omitempty"`
 }
 
 type Config struct {
 	UseBrowser   bool
+	Hybrid       bool
 	ShowBrowser  bool
 	BrowserDebug bool
 	CollectOnly  bool
 	DownloadOnly bool
+	RecordDir    string
+	ReplayDir    string
 	Workers      int
 	Site         string
+
+	HLTVBaseURL       string
+	CybersportBaseURL string
 }
 
 var (
@@ -47,10 +68,27 @@ var (
 		},
 	}
 
+	HLTVBaseURL       = "https://www.hltv.org"
+	CybersportBaseURL = "https://www.cybersport.ru"
+
+	// HLTVArchiveStart is the first year of the HLTV news archive walked by
+	// GetHLTVNewsIDs; ArchivePageDelay spaces its page requests
+	HLTVArchiveStart = 2006
+	ArchivePageDelay = 1500 * time.Millisecond
+
 	UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 
 	Browser *rod.Browser
 
+	// Hybrid is set when pages are fetched over HTTP with per-URL browser escalation
+	Hybrid *HybridFetcher
+
+	// ActiveCassette is set when fetches are recorded to or replayed from disk
+	ActiveCassette *Cassette
+
 	CFCookies   = make(map[string]string)
 	CookiesLock sync.RWMutex
+
+	Throttle = NewThrottleController(DefaultThrottleConfig())
+	Breakers = NewBreakerSet(DefaultBreakerConfig())
 )
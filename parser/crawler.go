@@ -11,7 +11,8 @@ import (
 )
 
 type CrawlerConfig struct {
-	Database      *Database
+	Database      DocumentStore
+	Writer        *BatchWriter
 	CorpusDir     string
 	DelayMs       int
 	ReCrawl       bool
@@ -95,30 +96,7 @@ func DownloadHLTVArticlesWithDB(articles []map[string]string, cfg *CrawlerConfig
 				}
 
 				if cfg.Database != nil {
-					exists, err := cfg.Database.DocumentExists(normalizedURL)
-					if err == nil && exists {
-						changed, err := cfg.Database.HasDocumentChanged(normalizedURL, html)
-						if err == nil {
-							if changed {
-								if err := cfg.Database.SaveDocument(normalizedURL, html, "hltv"); err != nil {
-									fmt.Printf("[HLTV] Failed to update in DB %s: %v\n", articleID, err)
-								} else {
-									fmt.Printf("[HLTV] Updated in DB (changed): %s\n", articleID)
-								}
-							} else {
-								cfg.Database.UpdateLastChecked(normalizedURL)
-								fmt.Printf("[HLTV] Document unchanged, updated timestamp: %s\n", articleID)
-							}
-						} else {
-							fmt.Printf("[HLTV] Error checking document change: %v\n", err)
-						}
-					} else {
-						if err := cfg.Database.SaveDocument(normalizedURL, html, "hltv"); err != nil {
-							fmt.Printf("[HLTV] Failed to save to DB %s: %v\n", articleID, err)
-						} else {
-							fmt.Printf("[HLTV] Saved to DB: %s\n", articleID)
-						}
-					}
+					recordCrawledPage(cfg, normalizedURL, html, "hltv", "HLTV", articleID)
 				}
 
 				mu.Lock()
@@ -217,30 +195,7 @@ func DownloadCybersportArticlesWithDB(articles []map[string]string, cfg *Crawler
 				}
 
 				if cfg.Database != nil {
-					exists, err := cfg.Database.DocumentExists(normalizedURL)
-					if err == nil && exists {
-						changed, err := cfg.Database.HasDocumentChanged(normalizedURL, html)
-						if err == nil {
-							if changed {
-								if err := cfg.Database.SaveDocument(normalizedURL, html, "cybersport"); err != nil {
-									fmt.Printf("[Cybersport] Failed to update in DB %s/%s: %v\n", tag, slug, err)
-								} else {
-									fmt.Printf("[Cybersport] Updated in DB (changed): %s/%s\n", tag, slug)
-								}
-							} else {
-								cfg.Database.UpdateLastChecked(normalizedURL)
-								fmt.Printf("[Cybersport] Document unchanged, updated timestamp: %s/%s\n", tag, slug)
-							}
-						} else {
-							fmt.Printf("[Cybersport] Error checking document change: %v\n", err)
-						}
-					} else {
-						if err := cfg.Database.SaveDocument(normalizedURL, html, "cybersport"); err != nil {
-							fmt.Printf("[Cybersport] Failed to save to DB %s/%s: %v\n", tag, slug, err)
-						} else {
-							fmt.Printf("[Cybersport] Saved to DB: %s/%s\n", tag, slug)
-						}
-					}
+					recordCrawledPage(cfg, normalizedURL, html, "cybersport", "Cybersport", tag+"/"+slug)
 				}
 
 				mu.Lock()
@@ -263,7 +218,84 @@ func DownloadCybersportArticlesWithDB(articles []map[string]string, cfg *Crawler
 	wg.Wait()
 }
 
-func AddExistingPagesToDB(corpusDir string, db *Database, source string) error {
+// recordCrawledPage hands a fetched page to the store. Only the stored hash is
+// read back; the write itself is batched when cfg.Writer is set.
+func recordCrawledPage(cfg *CrawlerConfig, normalizedURL, html, source, prefix, name string) {
+	hashes, err := cfg.Database.GetDocumentHashes([]string{normalizedURL})
+	if err != nil {
+		fmt.Printf("[%s] Error checking document change: %v\n", prefix, err)
+		return
+	}
+
+	write := DocumentWrite{URL: normalizedURL, RawHTML: html, Source: source}
+	prev, exists := hashes[normalizedURL]
+	unchanged := exists && prev == computeHTMLHash(html)
+	if unchanged {
+		write = DocumentWrite{URL: normalizedURL}
+	}
+
+	if cfg.Writer != nil {
+		if unchanged {
+			cfg.Writer.Touch(normalizedURL)
+		} else {
+			cfg.Writer.Save(normalizedURL, html, source)
+		}
+	} else if err := cfg.Database.WriteDocuments([]DocumentWrite{write}); err != nil {
+		fmt.Printf("[%s] Failed to save to DB %s: %v\n", prefix, name, err)
+		return
+	}
+
+	if !unchanged {
+		parseCrawledPage(cfg.Database, cfg.Writer, normalizedURL, html, source, prefix, name)
+	}
+
+	// Through the writer nothing is stored until its next flush
+	switch {
+	case cfg.Writer != nil && !exists:
+		fmt.Printf("[%s] Queued for DB: %s\n", prefix, name)
+	case cfg.Writer != nil && unchanged:
+		fmt.Printf("[%s] Document unchanged, queued timestamp update: %s\n", prefix, name)
+	case cfg.Writer != nil:
+		fmt.Printf("[%s] Queued update (changed): %s\n", prefix, name)
+	case !exists:
+		fmt.Printf("[%s] Saved to DB: %s\n", prefix, name)
+	case unchanged:
+		fmt.Printf("[%s] Document unchanged, updated timestamp: %s\n", prefix, name)
+	default:
+		fmt.Printf("[%s] Updated in DB (changed): %s\n", prefix, name)
+	}
+}
+
+// parseCrawledPage extracts a freshly saved page into the parsed articles of
+// the store, through writer when one is given
+func parseCrawledPage(store DocumentStore, writer *BatchWriter, normalizedURL, html, source, prefix, name string) {
+	article, err := ParseArticleFromHTML(source, html, normalizedURL)
+	if err != nil {
+		fmt.Printf("[%s] Not parsed %s: %v\n", prefix, name, err)
+		// A changed page that no longer extracts must not keep its old article
+		if writer != nil {
+			writer.DropParsed(normalizedURL)
+		} else if err := store.DeleteParsed([]string{normalizedURL}); err != nil {
+			fmt.Printf("[%s] Failed to drop parsed article %s: %v\n", prefix, name, err)
+		}
+		return
+	}
+
+	record := NewParsedRecord(DocIDFromURL(source, normalizedURL), article, computeHTMLHash(html))
+	if writer != nil {
+		writer.SaveParsed(record)
+		return
+	}
+	if err := store.SaveParsed([]*ParsedRecord{record}); err != nil {
+		fmt.Printf("[%s] Failed to save parsed article %s: %v\n", prefix, name, err)
+	}
+}
+
+const addBatchSize = 1000
+
+// AddExistingPagesToDB loads the downloaded pages of source into db and
+// parses them; listeners follow the parsed articles written
+func AddExistingPagesToDB(corpusDir string, db DocumentStore, source string, listeners ...ParsedListener) error {
 	var baseDir string
 	var urlBuilder func(map[string]string) string
 
@@ -297,9 +329,9 @@ func AddExistingPagesToDB(corpusDir string, db *Database, source string) error {
 		}
 	}
 
-	added := 0
 	skipped := 0
 	failed := 0
+	notParsed := 0
 	totalSize := int64(0)
 
 	fmt.Printf("Loading existing pages to database\n")
@@ -311,56 +343,76 @@ func AddExistingPagesToDB(corpusDir string, db *Database, source string) error {
 	bar.SetTemplateString(`[{{counters . }}] {{bar . }} {{percent . }} | {{etime . }}`)
 	bar.Start()
 
-	for _, articleInfo := range articles {
-		url := urlBuilder(articleInfo)
-		normalizedURL, err := NormalizeURL(url)
-		if err != nil {
-			failed++
-			bar.Increment()
-			continue
-		}
+	writer := NewBatchWriter(db, addBatchSize, 0)
+	for _, l := range listeners {
+		writer.AddListener(l)
+	}
 
-		exists, err := db.DocumentExists(normalizedURL)
-		if err != nil {
-			failed++
-			bar.Increment()
-			continue
-		}
-		if exists {
-			skipped++
-			bar.Increment()
-			continue
+	// One hash lookup per chunk instead of one query per page
+	for chunkStart := 0; chunkStart < len(articles); chunkStart += addBatchSize {
+		chunkEnd := chunkStart + addBatchSize
+		if chunkEnd > len(articles) {
+			chunkEnd = len(articles)
 		}
+		chunk := articles[chunkStart:chunkEnd]
 
-		var htmlPath string
-		if source == "hltv" {
-			safeID := SanitizeFilename(articleInfo["id"])
-			htmlPath = filepath.Join(baseDir, safeID+".html")
-		} else {
-			safeName := SanitizeFilename(articleInfo["tag"] + "__" + articleInfo["slug"])
-			htmlPath = filepath.Join(baseDir, safeName+".html")
+		urls := make([]string, len(chunk))
+		for i, articleInfo := range chunk {
+			urls[i], _ = NormalizeURL(urlBuilder(articleInfo))
 		}
 
-		htmlBytes, err := os.ReadFile(htmlPath)
+		known, err := db.GetDocumentHashes(urls)
 		if err != nil {
-			failed++
-			bar.Increment()
+			failed += len(chunk)
+			bar.Add(len(chunk))
 			continue
 		}
 
-		html := string(htmlBytes)
-		totalSize += int64(len(html))
+		for i, articleInfo := range chunk {
+			normalizedURL := urls[i]
+			if normalizedURL == "" {
+				failed++
+				bar.Increment()
+				continue
+			}
+			if _, exists := known[normalizedURL]; exists {
+				skipped++
+				bar.Increment()
+				continue
+			}
 
-		if err := db.SaveDocument(normalizedURL, html, source); err != nil {
-			failed++
+			var htmlPath string
+			if source == "hltv" {
+				safeID := SanitizeFilename(articleInfo["id"])
+				htmlPath = filepath.Join(baseDir, safeID+".html")
+			} else {
+				safeName := SanitizeFilename(articleInfo["tag"] + "__" + articleInfo["slug"])
+				htmlPath = filepath.Join(baseDir, safeName+".html")
+			}
+
+			htmlBytes, err := os.ReadFile(htmlPath)
+			if err != nil {
+				failed++
+				bar.Increment()
+				continue
+			}
+
+			html := string(htmlBytes)
+			totalSize += int64(len(html))
+			writer.Save(normalizedURL, html, source)
+			if article, err := ParseArticleFromHTML(source, html, normalizedURL); err == nil {
+				writer.SaveParsed(NewParsedRecord(DocIDFromURL(source, normalizedURL), article, computeHTMLHash(html)))
+			} else {
+				notParsed++
+			}
 			bar.Increment()
-			continue
 		}
-
-		added++
-		bar.Increment()
 	}
 
+	writer.Close()
+	added, writeFailed := writer.Counts()
+	failed += writeFailed
+
 	bar.Finish()
 
 	fmt.Printf("\nLoading Results\n")
@@ -368,6 +420,7 @@ func AddExistingPagesToDB(corpusDir string, db *Database, source string) error {
 	fmt.Printf("Added:           %d\n", added)
 	fmt.Printf("Skipped:         %d (already in DB)\n", skipped)
 	fmt.Printf("Errors:          %d\n", failed)
+	fmt.Printf("Not parsed:      %d (run \"reparse\" for details)\n", notParsed)
 	fmt.Printf("Data size:       %s\n", formatBytes(totalSize))
 	fmt.Printf("Size in DB (~15%%): %s\n\n", formatBytes(int64(float64(totalSize)*1.15)))
 	return nil
@@ -11,7 +11,7 @@ import (
 )
 
 func ParseCybersportArticle(tag string, slug string) (*Article, error) {
-	url := fmt.Sprintf("https://www.cybersport.ru/tags/%s/%s", tag, slug)
+	url := BuildCybersportURL(tag, slug)
 	doc, err := FetchPage(url)
 	if err != nil {
 		return nil, err
@@ -31,25 +31,25 @@ func ParseCybersportArticle(tag string, slug string) (*Article, error) {
 		})
 	})
 
+	extractor := StrategySelectors
 	if contentBuilder.Len() < 500 {
-		doc.Find("p").Each(func(i int, s *goquery.Selection) {
-			text := strings.TrimSpace(s.Text())
-			if text != "" && len(text) > 20 {
-				contentBuilder.WriteString(text)
-				contentBuilder.WriteString("\n\n")
-			}
-		})
+		if paragraphs := ExtractMainContent(doc); len(paragraphs) > 0 {
+			contentBuilder.Reset()
+			contentBuilder.WriteString(joinParagraphs(paragraphs))
+			extractor = StrategyReadability
+		}
 	}
 
 	content := strings.TrimSpace(contentBuilder.String())
 
 	return &Article{
-		ID:      slug,
-		URL:     url,
-		Title:   title,
-		Content: content,
-		Source:  "cybersport",
-		Tag:     tag,
+		ID:        slug,
+		URL:       url,
+		Title:     title,
+		Content:   content,
+		Source:    "cybersport",
+		Tag:       tag,
+		Extractor: extractor,
 	}, nil
 }
 
@@ -61,6 +61,26 @@ func GetCybersportArticles() ([]map[string]string, error) {
 
 	for _, tag := range tags {
 		fmt.Printf("Tag: %s\n", tag)
+		url := fmt.Sprintf("%s/tags/%s", CybersportBaseURL, tag)
+
+		// The tag feed is loaded by scrolling in the browser; a recorded
+		// cassette holds the final state of the page
+		if Replaying() {
+			doc, err := ActiveCassette.FetchPage(url)
+			if err != nil {
+				fmt.Printf("  %s: %v\n", tag, err)
+				continue
+			}
+			n := collectCybersportLinks(doc, tag, seen, &articles)
+			fmt.Printf("  %s: %d articles from cassette\n", tag, n)
+			continue
+		}
+
+		if Browser == nil && Hybrid != nil {
+			if err := Hybrid.StartBrowser(); err != nil {
+				fmt.Printf("Browser error: %v\n", err)
+			}
+		}
 		if Browser == nil {
 			fmt.Println("Browser error")
 			break
@@ -69,7 +89,6 @@ func GetCybersportArticles() ([]map[string]string, error) {
 		page := Browser.MustPage("")
 		defer page.MustClose()
 
-		url := fmt.Sprintf("https://www.cybersport.ru/tags/%s", tag)
 		err := rod.Try(func() {
 			page.MustNavigate(url)
 			page.MustWaitLoad()
@@ -117,26 +136,7 @@ func GetCybersportArticles() ([]map[string]string, error) {
 
 			html := page.MustHTML()
 			doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-
-			doc.Find("a[href*='/tags/" + tag + "/']").Each(func(i int, s *goquery.Selection) {
-				href, exists := s.Attr("href")
-				if !exists {
-					return
-				}
-
-				re := regexp.MustCompile(`/tags/` + tag + `/([^?#]+)`)
-				matches := re.FindStringSubmatch(href)
-				if len(matches) == 2 {
-					slug := strings.Trim(matches[1], "/")
-					if slug != "" && slug != tag && !strings.Contains(slug, "page") {
-						key := tag + "/" + slug
-						if !seen[key] {
-							seen[key] = true
-							articles = append(articles, map[string]string{"tag": tag, "slug": slug})
-						}
-					}
-				}
-			})
+			collectCybersportLinks(doc, tag, seen, &articles)
 
 			countAfter := len(articles)
 
@@ -157,6 +157,41 @@ func GetCybersportArticles() ([]map[string]string, error) {
 				break
 			}
 		}
+
+		if ActiveCassette != nil {
+			if html, err := page.HTML(); err == nil {
+				ActiveCassette.RecordHTML(url, html, "browser")
+			}
+		}
 	}
 	return articles, nil
 }
+
+// collectCybersportLinks appends article links of a tag feed that weren't
+// seen yet and returns how many were added
+func collectCybersportLinks(doc *goquery.Document, tag string, seen map[string]bool, articles *[]map[string]string) int {
+	re := regexp.MustCompile(`/tags/` + regexp.QuoteMeta(tag) + `/([^?#]+)`)
+	added := 0
+
+	doc.Find("a[href*='/tags/" + tag + "/']").Each(func(i int, s *goquery.Selection) {
+		href, exists := s.Attr("href")
+		if !exists {
+			return
+		}
+
+		matches := re.FindStringSubmatch(href)
+		if len(matches) == 2 {
+			slug := strings.Trim(matches[1], "/")
+			if slug != "" && slug != tag && !strings.Contains(slug, "page") {
+				key := tag + "/" + slug
+				if !seen[key] {
+					seen[key] = true
+					*articles = append(*articles, map[string]string{"tag": tag, "slug": slug})
+					added++
+				}
+			}
+		}
+	})
+
+	return added
+}
@@ -2,12 +2,9 @@ package parser
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/cheggaaa/pb/v3"
 )
 
 func ParseCybersportArticleFromHTML(html string, sourceURL string) (*Article, error) {
@@ -20,88 +17,45 @@ func ParseCybersportArticleFromHTML(html string, sourceURL string) (*Article, er
 		return nil, err
 	}
 
+	metadata := extractMetadata(doc)
 	title := strings.TrimSpace(doc.Find(".n-common-article__title, h1").First().Text())
-
-	var contentBuilder strings.Builder
-
 	lead := strings.TrimSpace(doc.Find(".n-common-article__lead").Text())
-	if lead != "" {
-		contentBuilder.WriteString(lead)
-		contentBuilder.WriteString("\n\n")
-	}
 
+	var paragraphs []string
 	doc.Find("[class^='paragraph_'], [data-test-id='article-content'] p, .post-content p").Each(func(i int, s *goquery.Selection) {
 		text := strings.TrimSpace(s.Text())
 		if text != "" {
-			contentBuilder.WriteString(text)
-			contentBuilder.WriteString("\n\n")
+			paragraphs = append(paragraphs, text)
 		}
 	})
 
-	article := &Article{
-		URL:     sourceURL,
-		Title:   title,
-		Content: strings.TrimSpace(contentBuilder.String()),
-	}
-
-	return article, nil
-}
-
-func ProcessCybersportRawFiles(corpusDir string) error {
-	rawDir := filepath.Join(corpusDir, "cybersport/raw")
-	parsedDir := filepath.Join(corpusDir, "cybersport/parsed")
-
-	os.MkdirAll(parsedDir, 0755)
-
-	entries, err := os.ReadDir(rawDir)
-	if err != nil {
-		return fmt.Errorf("failed to read raw directory: %w", err)
-	}
-
-	var targets []os.DirEntry
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".html") {
-			targets = append(targets, entry)
+	extractor := StrategySelectors
+	if len(paragraphs) == 0 {
+		for _, p := range ExtractMainContent(doc) {
+			if p == lead {
+				continue
+			}
+			paragraphs = append(paragraphs, p)
+			extractor = StrategyReadability
 		}
 	}
 
-	if len(targets) == 0 {
-		return fmt.Errorf("no html files found in %s", rawDir)
-	}
-
-	bar := pb.New(len(targets))
-	bar.SetTemplateString(`[{{counters . }}] {{bar . }} {{percent . }} | {{etime . }}`)
-	bar.Start()
-
-	processed := 0
-	for _, entry := range targets {
-		rawPath := filepath.Join(rawDir, entry.Name())
-		htmlBytes, err := os.ReadFile(rawPath)
-		if err != nil {
-			bar.Increment()
-			continue
-		}
-
-		article, err := ParseCybersportArticleFromHTML(string(htmlBytes), "")
-		if err != nil {
-			bar.Increment()
-			continue
-		}
-
-		textFileName := strings.TrimSuffix(entry.Name(), ".html") + ".txt"
-		textPath := filepath.Join(parsedDir, textFileName)
-
-		output := fmt.Sprintf("%s\n\n%s", article.Title, article.Content)
-		err = os.WriteFile(textPath, []byte(output), 0644)
-		if err == nil {
-			processed++
-		}
-
-		bar.Increment()
+	article := &Article{
+		ID:         ArticleIDFromURL("cybersport", sourceURL),
+		URL:        sourceURL,
+		Title:      title,
+		Lead:       lead,
+		Paragraphs: paragraphs,
+		Content:    joinArticleText(lead, paragraphs),
+		Source:     "cybersport",
+		Tag:        cybersportTagFromURL(sourceURL),
+		Metadata:   metadata,
+		Extractor:  extractor,
+	}
+
+	if err := IsEmptyArticle(article); err != nil {
+		return nil, err
 	}
 
-	bar.Finish()
-	fmt.Printf("Processed: %d/%d\n", processed, len(targets))
-
-	return nil
+	return article, nil
 }
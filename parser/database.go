@@ -14,22 +14,28 @@ import (
 )
 
 type Document struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	URL         string             `bson:"url"`
-	RawHTML     string             `bson:"raw_html"`
-	Source      string             `bson:"source"`
-	CrawlTime   int64              `bson:"crawl_time"`
-	HTMLHash    string             `bson:"html_hash"`
-	LastChecked int64              `bson:"last_checked"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	URL         string             `bson:"url" json:"url"`
+	RawHTML     string             `bson:"raw_html" json:"raw_html"`
+	Source      string             `bson:"source" json:"source"`
+	CrawlTime   int64              `bson:"crawl_time" json:"crawl_time"`
+	HTMLHash    string             `bson:"html_hash" json:"html_hash"`
+	LastChecked int64              `bson:"last_checked" json:"last_checked"`
+	Versions    []DocumentVersion  `bson:"versions,omitempty" json:"versions,omitempty"`
 }
 
-type Database struct {
+// MongoStore is the DocumentStore backed by a MongoDB collection
+type MongoStore struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	raw        *mongo.Collection
+	parsed     *mongo.Collection
+	metadata   *mongo.Collection
+	schemaID   string
 	ctx        context.Context
 }
 
-func NewDatabase(uri, dbName, collectionName string) (*Database, error) {
+func NewMongoStore(uri, dbName, collectionName, parsedCollection string) (*MongoStore, error) {
 	ctx := context.Background()
 
 	clientOptions := options.Client().ApplyURI(uri)
@@ -45,22 +51,39 @@ func NewDatabase(uri, dbName, collectionName string) (*Database, error) {
 	db := client.Database(dbName)
 	collection := db.Collection(collectionName)
 
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "url", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	store := &MongoStore{
+		client:     client,
+		collection: collection,
+		raw:        db.Collection(collectionName + "_raw"),
+		parsed:     db.Collection(parsedCollection),
+		metadata:   db.Collection("metadata"),
+		schemaID:   "schema:" + collectionName,
+		ctx:        ctx,
 	}
-	_, err = collection.Indexes().CreateOne(ctx, indexModel)
+
+	version, err := store.SchemaVersion()
 	if err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version == 0 {
+		// A fresh collection is migrated right away, there is nothing to backfill
+		if count, err := collection.EstimatedDocumentCount(ctx); err == nil && count == 0 {
+			if _, err := store.Migrate(); err != nil {
+				client.Disconnect(ctx)
+				return nil, err
+			}
+			version = LatestSchemaVersion()
+		}
+	}
+	if version < LatestSchemaVersion() {
+		fmt.Printf("Warning: database schema is at version %d, latest is %d; run \"migrate\" to create indexes and backfill documents\n", version, LatestSchemaVersion())
 	}
 
-	return &Database{
-		client:     client,
-		collection: collection,
-		ctx:        ctx,
-	}, nil
+	return store, nil
 }
 
-func (db *Database) Close() error {
+func (db *MongoStore) Close() error {
 	return db.client.Disconnect(db.ctx)
 }
 
@@ -89,10 +112,28 @@ func computeHTMLHash(html string) string {
 	return fmt.Sprintf("%x", hash)
 }
 
-func (db *Database) SaveDocument(normalizedURL, rawHTML, source string) error {
+// SaveDocument makes rawHTML the current version of the document. Earlier
+// captures stay available through the version list.
+func (db *MongoStore) SaveDocument(normalizedURL, rawHTML, source string) error {
 	htmlHash := computeHTMLHash(rawHTML)
 	crawlTime := time.Now().Unix()
 
+	prev, err := db.GetDocument(normalizedURL)
+	if err != nil {
+		return err
+	}
+	versions, seed, added := appendVersion(prev, rawHTML, htmlHash, crawlTime)
+	if seed != nil {
+		if err := db.putRaw(seed.Hash, prev.RawHTML); err != nil {
+			return err
+		}
+	}
+	if added {
+		if err := db.putRaw(htmlHash, rawHTML); err != nil {
+			return err
+		}
+	}
+
 	filter := bson.M{"url": normalizedURL}
 	update := bson.M{
 		"$set": bson.M{
@@ -101,15 +142,37 @@ func (db *Database) SaveDocument(normalizedURL, rawHTML, source string) error {
 			"crawl_time":   crawlTime,
 			"html_hash":    htmlHash,
 			"last_checked": crawlTime,
+			"versions":     versions,
 		},
 	}
 
 	opts := options.Update().SetUpsert(true)
-	_, err := db.collection.UpdateOne(db.ctx, filter, update, opts)
+	_, err = db.collection.UpdateOne(db.ctx, filter, update, opts)
+	return err
+}
+
+func (db *MongoStore) putRaw(hash, rawHTML string) error {
+	filter := bson.M{"_id": hash}
+	update := bson.M{"$setOnInsert": bson.M{"raw_html": rawHTML}}
+	_, err := db.raw.UpdateOne(db.ctx, filter, update, options.Update().SetUpsert(true))
 	return err
 }
 
-func (db *Database) DocumentExists(normalizedURL string) (bool, error) {
+func (db *MongoStore) GetRawVersion(hash string) (string, error) {
+	var blob struct {
+		RawHTML string `bson:"raw_html"`
+	}
+	err := db.raw.FindOne(db.ctx, bson.M{"_id": hash}).Decode(&blob)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return blob.RawHTML, nil
+}
+
+func (db *MongoStore) DocumentExists(normalizedURL string) (bool, error) {
 	filter := bson.M{"url": normalizedURL}
 	count, err := db.collection.CountDocuments(db.ctx, filter)
 	if err != nil {
@@ -118,7 +181,7 @@ func (db *Database) DocumentExists(normalizedURL string) (bool, error) {
 	return count > 0, nil
 }
 
-func (db *Database) GetDocument(normalizedURL string) (*Document, error) {
+func (db *MongoStore) GetDocument(normalizedURL string) (*Document, error) {
 	var doc Document
 	filter := bson.M{"url": normalizedURL}
 	err := db.collection.FindOne(db.ctx, filter).Decode(&doc)
@@ -131,24 +194,144 @@ func (db *Database) GetDocument(normalizedURL string) (*Document, error) {
 	return &doc, nil
 }
 
-func (db *Database) HasDocumentChanged(normalizedURL, newHTML string) (bool, error) {
-	doc, err := db.GetDocument(normalizedURL)
+func (db *MongoStore) GetDocumentHashes(normalizedURLs []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(normalizedURLs))
+	if len(normalizedURLs) == 0 {
+		return hashes, nil
+	}
+
+	filter := bson.M{"url": bson.M{"$in": normalizedURLs}}
+	opts := options.Find().SetProjection(bson.M{"_id": 0, "url": 1, "html_hash": 1})
+	cursor, err := db.collection.Find(db.ctx, filter, opts)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	defer cursor.Close(db.ctx)
+
+	for cursor.Next(db.ctx) {
+		var doc struct {
+			URL      string `bson:"url"`
+			HTMLHash string `bson:"html_hash"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		hashes[doc.URL] = doc.HTMLHash
+	}
+	return hashes, cursor.Err()
+}
+
+// versionState is what WriteDocuments needs to know about a stored document
+type versionState struct {
+	hash      string
+	versioned bool
+}
+
+// versionStates returns the hash of each known URL and whether it has a
+// version history yet, without loading raw HTML
+func (db *MongoStore) versionStates(normalizedURLs []string) (map[string]versionState, error) {
+	states := make(map[string]versionState, len(normalizedURLs))
+	filter := bson.M{"url": bson.M{"$in": normalizedURLs}}
+	opts := options.Find().SetProjection(bson.M{"_id": 0, "url": 1, "html_hash": 1, "versions": bson.M{"$slice": -1}})
+	cursor, err := db.collection.Find(db.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(db.ctx)
+
+	for cursor.Next(db.ctx) {
+		var doc struct {
+			URL      string            `bson:"url"`
+			HTMLHash string            `bson:"html_hash"`
+			Versions []DocumentVersion `bson:"versions"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		states[doc.URL] = versionState{hash: doc.HTMLHash, versioned: len(doc.Versions) > 0}
+	}
+	return states, cursor.Err()
+}
+
+// WriteDocuments applies a batch with two unordered BulkWrites, one for the
+// raw version contents and one for the documents. Changed documents get their
+// new version pushed onto the history; a document saved before versioning
+// first has its old capture seeded, as SaveDocument does.
+func (db *MongoStore) WriteDocuments(writes []DocumentWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	urls := make([]string, 0, len(writes))
+	for _, w := range writes {
+		urls = append(urls, w.URL)
+	}
+	states, err := db.versionStates(urls)
+	if err != nil {
+		return err
 	}
-	if doc == nil {
-		return true, nil
+	putRaw := func(hash, rawHTML string) mongo.WriteModel {
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": hash}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"raw_html": rawHTML}}).
+			SetUpsert(true)
+	}
+
+	now := time.Now().Unix()
+	var docOps, rawOps []mongo.WriteModel
+	for _, w := range writes {
+		filter := bson.M{"url": w.URL}
+		if w.RawHTML == "" {
+			update := bson.M{"$set": bson.M{"last_checked": now}}
+			docOps = append(docOps, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update))
+			continue
+		}
+
+		htmlHash := computeHTMLHash(w.RawHTML)
+		set := bson.M{
+			"raw_html":     w.RawHTML,
+			"source":       w.Source,
+			"crawl_time":   now,
+			"html_hash":    htmlHash,
+			"last_checked": now,
+		}
+		update := bson.M{"$set": set}
+		prev, ok := states[w.URL]
+		switch {
+		case ok && prev.hash == htmlHash:
+		case ok && !prev.versioned:
+			old, err := db.GetDocument(w.URL)
+			if err != nil {
+				return err
+			}
+			versions, seed, _ := appendVersion(old, w.RawHTML, htmlHash, now)
+			if seed != nil {
+				rawOps = append(rawOps, putRaw(seed.Hash, old.RawHTML))
+			}
+			set["versions"] = versions
+			rawOps = append(rawOps, putRaw(htmlHash, w.RawHTML))
+		default:
+			update["$push"] = bson.M{"versions": DocumentVersion{Hash: htmlHash, FetchedAt: now, RawRef: htmlHash, Size: len(w.RawHTML)}}
+			rawOps = append(rawOps, putRaw(htmlHash, w.RawHTML))
+		}
+		docOps = append(docOps, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
 	}
 
-	if newHTML == "" {
-		return true, nil
+	opts := options.BulkWrite().SetOrdered(false)
+	if len(rawOps) > 0 {
+		if _, err := db.raw.BulkWrite(db.ctx, rawOps, opts); err != nil {
+			return err
+		}
 	}
+	_, err = db.collection.BulkWrite(db.ctx, docOps, opts)
+	return err
+}
 
-	newHash := computeHTMLHash(newHTML)
-	return doc.HTMLHash != newHash, nil
+func (db *MongoStore) HasDocumentChanged(normalizedURL, newHTML string) (bool, error) {
+	return documentChanged(db, normalizedURL, newHTML)
 }
 
-func (db *Database) GetDocumentsForReCrawl(reCrawlInterval int) ([]Document, error) {
+func (db *MongoStore) GetDocumentsForReCrawl(reCrawlInterval int) ([]Document, error) {
 	if reCrawlInterval <= 0 {
 		return nil, nil
 	}
@@ -174,7 +357,7 @@ func (db *Database) GetDocumentsForReCrawl(reCrawlInterval int) ([]Document, err
 	return docs, nil
 }
 
-func (db *Database) UpdateLastChecked(normalizedURL string) error {
+func (db *MongoStore) UpdateLastChecked(normalizedURL string) error {
 	filter := bson.M{"url": normalizedURL}
 	update := bson.M{
 		"$set": bson.M{
@@ -185,7 +368,7 @@ func (db *Database) UpdateLastChecked(normalizedURL string) error {
 	return err
 }
 
-func (db *Database) GetLastProcessedURL() (string, error) {
+func (db *MongoStore) GetLastProcessedURL() (string, error) {
 	opts := options.FindOne().SetSort(bson.D{{Key: "crawl_time", Value: -1}})
 	var doc Document
 	err := db.collection.FindOne(db.ctx, bson.M{}, opts).Decode(&doc)
@@ -197,3 +380,99 @@ func (db *Database) GetLastProcessedURL() (string, error) {
 	}
 	return doc.URL, nil
 }
+
+func (db *MongoStore) ForEach(fn func(*Document) error) error {
+	return db.ForEachMatching(DocumentFilter{}, fn)
+}
+
+// ForEachMatching lets MongoDB apply the filter, on the source and
+// crawl_time indexes
+func (db *MongoStore) ForEachMatching(filter DocumentFilter, fn func(*Document) error) error {
+	query := bson.M{}
+	if filter.Source != "" {
+		query["source"] = filter.Source
+	}
+	crawled := bson.M{}
+	if !filter.From.IsZero() {
+		crawled["$gte"] = filter.From.Unix()
+	}
+	if !filter.To.IsZero() {
+		crawled["$lt"] = filter.To.Unix()
+	}
+	if len(crawled) > 0 {
+		query["crawl_time"] = crawled
+	}
+
+	cursor, err := db.collection.Find(db.ctx, query)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(db.ctx)
+
+	for cursor.Next(db.ctx) {
+		var doc Document
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(&doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// SaveParsed upserts the records with one unordered BulkWrite
+func (db *MongoStore) SaveParsed(records []*ParsedRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	ops := make([]mongo.WriteModel, 0, len(records))
+	for _, r := range records {
+		ops = append(ops, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"url": r.URL}).
+			SetReplacement(r).
+			SetUpsert(true))
+	}
+	_, err := db.parsed.BulkWrite(db.ctx, ops, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (db *MongoStore) DeleteParsed(normalizedURLs []string) error {
+	if len(normalizedURLs) == 0 {
+		return nil
+	}
+	_, err := db.parsed.DeleteMany(db.ctx, bson.M{"url": bson.M{"$in": normalizedURLs}})
+	return err
+}
+
+func (db *MongoStore) GetParsed(normalizedURL string) (*ParsedRecord, error) {
+	var record ParsedRecord
+	err := db.parsed.FindOne(db.ctx, bson.M{"url": normalizedURL}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (db *MongoStore) ForEachParsed(fn func(*ParsedRecord) error) error {
+	cursor, err := db.parsed.Find(db.ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(db.ctx)
+
+	for cursor.Next(db.ctx) {
+		var record ParsedRecord
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
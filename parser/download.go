@@ -34,15 +34,32 @@ func SaveRawHTML(html string, dir, filename string) error {
 	return os.WriteFile(fpath, []byte(html), 0o644)
 }
 
+// FetchURLHTML fetches a page through the circuit breaker of its domain, so
+// workers pause while the domain sits behind an anti-bot wall
 func FetchURLHTML(url string) (string, error) {
+	domain := ExtractDomain(url)
+	if domain == "" {
+		domain = hostOf(url)
+	}
+	breaker := Breakers.Domain(domain)
+	breaker.Wait()
+
 	doc, err := FetchPage(url)
 	if err != nil {
+		// A 403/503 wall counts in the window; other errors only fail a probe
+		if IsBlockedStatus(err) {
+			breaker.Record(true, false)
+		} else {
+			breaker.Record(false, true)
+		}
 		return "", err
 	}
 	html, err := doc.Html()
 	if err != nil {
+		breaker.Record(false, true)
 		return "", err
 	}
+	breaker.Record(IsBlockedHTML(html) != nil, false)
 	return html, nil
 }
 
@@ -194,9 +211,9 @@ func DownloadCybersportArticles(articles []map[string]string, corpusDir string,
 }
 
 func BuildHLTVURL(articleID, slug string) string {
-	return fmt.Sprintf("https://www.hltv.org/news/%s/%s", articleID, slug)
+	return fmt.Sprintf("%s/news/%s/%s", HLTVBaseURL, articleID, slug)
 }
 
 func BuildCybersportURL(tag, slug string) string {
-	return fmt.Sprintf("https://www.cybersport.ru/tags/%s/%s", tag, slug)
+	return fmt.Sprintf("%s/tags/%s/%s", CybersportBaseURL, tag, slug)
 }
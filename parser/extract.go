@@ -0,0 +1,15 @@
+package parser
+
+import "fmt"
+
+// ParseArticleFromHTML runs the extractor of the given source over raw HTML
+func ParseArticleFromHTML(source, html, sourceURL string) (*Article, error) {
+	switch source {
+	case "hltv":
+		return ParseHLTVArticleFromHTML(html, sourceURL)
+	case "cybersport":
+		return ParseCybersportArticleFromHTML(html, sourceURL)
+	default:
+		return nil, fmt.Errorf("unknown source: %s", source)
+	}
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureDir is where the extractor golden files live, relative to the repo root
+const FixtureDir = "parser/testdata/golden"
+
+// Golden is the expected extractor output for one saved HTML page. URL is an
+// input of the extractor and is kept when goldens are regenerated.
+type Golden struct {
+	URL       string           `json:"url"`
+	Source    string           `json:"source"`
+	Tag       string           `json:"tag,omitempty"`
+	Title     string           `json:"title"`
+	Lead      string           `json:"lead,omitempty"`
+	Content   string           `json:"content"`
+	Metadata  *ArticleMetadata `json:"metadata,omitempty"`
+	Extractor string           `json:"extractor,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// BuildGolden runs the extractor of source over html and records its output,
+// including extraction errors, so rejected pages are covered too
+func BuildGolden(source, html, sourceURL string) *Golden {
+	golden := &Golden{URL: sourceURL, Source: source}
+
+	article, err := ParseArticleFromHTML(source, html, sourceURL)
+	if err != nil {
+		golden.Error = err.Error()
+		return golden
+	}
+
+	golden.Tag = article.Tag
+	golden.Title = article.Title
+	golden.Lead = article.Lead
+	golden.Content = article.Content
+	golden.Metadata = &article.Metadata
+	golden.Extractor = article.Extractor
+	return golden
+}
+
+func ReadGolden(path string) (*Golden, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var golden Golden
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return nil, fmt.Errorf("failed to decode golden %s: %w", path, err)
+	}
+	return &golden, nil
+}
+
+func WriteGolden(path string, golden *Golden) error {
+	data, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// GoldenPath returns the golden file that belongs to a fixture HTML file
+func GoldenPath(htmlPath string) string {
+	return strings.TrimSuffix(htmlPath, ".html") + ".golden.json"
+}
+
+// AddFixture copies a raw page into the fixture suite of its source and
+// writes a golden file with the current extractor output
+func AddFixture(fixtureDir, source, rawPath, name, sourceURL string) (string, error) {
+	if source != "hltv" && source != "cybersport" {
+		return "", fmt.Errorf("unknown source: %s", source)
+	}
+
+	htmlBytes, err := os.ReadFile(rawPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read raw page: %w", err)
+	}
+
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(rawPath), ".html")
+	}
+	name = SanitizeFilename(name)
+
+	dir := filepath.Join(fixtureDir, source)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	htmlPath := filepath.Join(dir, name+".html")
+	if _, err := os.Stat(htmlPath); err == nil {
+		return "", fmt.Errorf("fixture already exists: %s", htmlPath)
+	}
+	if err := os.WriteFile(htmlPath, htmlBytes, 0644); err != nil {
+		return "", err
+	}
+
+	golden := BuildGolden(source, string(htmlBytes), sourceURL)
+	if err := WriteGolden(GoldenPath(htmlPath), golden); err != nil {
+		return "", err
+	}
+
+	return htmlPath, nil
+}
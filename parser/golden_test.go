@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current extractor output")
+
+func TestExtractorGoldens(t *testing.T) {
+	htmlFiles, err := filepath.Glob(filepath.Join("testdata", "golden", "*", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(htmlFiles) == 0 {
+		t.Fatal("no fixtures found in testdata/golden")
+	}
+
+	for _, htmlPath := range htmlFiles {
+		source := filepath.Base(filepath.Dir(htmlPath))
+		name := source + "/" + strings.TrimSuffix(filepath.Base(htmlPath), ".html")
+
+		t.Run(name, func(t *testing.T) {
+			html, err := os.ReadFile(htmlPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := GoldenPath(htmlPath)
+			want, err := ReadGolden(goldenPath)
+			if err != nil && !(*update && os.IsNotExist(err)) {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+
+			sourceURL := ""
+			if want != nil {
+				sourceURL = want.URL
+			}
+			got := BuildGolden(source, string(html), sourceURL)
+
+			if *update {
+				if err := WriteGolden(goldenPath, got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			checkGoldenField(t, "error", want.Error, got.Error)
+			checkGoldenField(t, "source", want.Source, got.Source)
+			checkGoldenField(t, "tag", want.Tag, got.Tag)
+			checkGoldenField(t, "title", want.Title, got.Title)
+			checkGoldenField(t, "lead", want.Lead, got.Lead)
+			checkGoldenField(t, "content", want.Content, got.Content)
+			checkGoldenField(t, "metadata", metadataString(want.Metadata), metadataString(got.Metadata))
+			checkGoldenField(t, "extractor", want.Extractor, got.Extractor)
+		})
+	}
+}
+
+func metadataString(meta *ArticleMetadata) string {
+	if meta == nil {
+		return ""
+	}
+	data, _ := json.Marshal(meta)
+	return string(data)
+}
+
+func checkGoldenField(t *testing.T, field, want, got string) {
+	t.Helper()
+	if want != got {
+		t.Errorf("%s mismatch (run with -update to accept)\nwant: %q\ngot:  %q", field, want, got)
+	}
+}
@@ -13,7 +13,7 @@ import (
 
 // ParseHLTVArticle parses a single HLTV article
 func ParseHLTVArticle(id string, slug string) (*Article, error) {
-	url := fmt.Sprintf("https://www.hltv.org/news/%s/%s", id, slug)
+	url := BuildHLTVURL(id, slug)
 	doc, err := FetchPage(url)
 	if err != nil {
 		return nil, err
@@ -56,53 +56,23 @@ func ParseHLTVArticle(id string, slug string) (*Article, error) {
 		}
 	}
 
-	// Fallback method if no content found
+	extractor := StrategySelectors
 	if !foundContent {
-		doc.Find("p, blockquote").Each(func(i int, s *goquery.Selection) {
-			// Check if element is not inside script/style/nav
-			if s.Closest("script, style, noscript, nav, header, footer").Length() > 0 {
-				return
-			}
-
-			className, _ := s.Parent().Attr("class")
-			if strings.Contains(className, "comment") ||
-				strings.Contains(className, "forum") ||
-				strings.Contains(className, "navigation") {
-				return
-			}
-
-			text := strings.TrimSpace(s.Text())
-			if text == "" || len(text) < 15 {
-				return
-			}
-
-			// Strict filtering of JS/CSS content
-			if strings.Contains(text, "{") && strings.Contains(text, "}") {
-				return
-			}
-			if strings.Contains(text, "window.") || strings.Contains(text, "document.") {
-				return
-			}
-			if strings.Contains(text, "appendChild") || strings.Contains(text, "createElement") {
-				return
-			}
-
-			if goquery.NodeName(s) == "blockquote" {
-				contentBuilder.WriteString("> ")
-			}
-			contentBuilder.WriteString(text)
-			contentBuilder.WriteString("\n\n")
-		})
+		if paragraphs := ExtractMainContent(doc); len(paragraphs) > 0 {
+			contentBuilder.WriteString(joinParagraphs(paragraphs))
+			extractor = StrategyReadability
+		}
 	}
 
 	content := strings.TrimSpace(contentBuilder.String())
 
 	return &Article{
-		ID:      id,
-		URL:     url,
-		Title:   title,
-		Content: content,
-		Source:  "hltv",
+		ID:        id,
+		URL:       url,
+		Title:     title,
+		Content:   content,
+		Source:    "hltv",
+		Extractor: extractor,
 	}, nil
 }
 
@@ -120,26 +90,18 @@ func GetHLTVNewsIDs() ([]map[string]string, error) {
 	}
 
 	currentYear := time.Now().Year()
-	consecutiveErrors := 0
 
-	for year := 2006; year <= currentYear; year++ {
+	for year := HLTVArchiveStart; year <= currentYear; year++ {
 		for _, month := range months {
-			url := fmt.Sprintf("https://www.hltv.org/news/archive/%d/%s", year, month)
+			url := fmt.Sprintf("%s/news/archive/%d/%s", HLTVBaseURL, year, month)
 
 			doc, err := FetchPage(url)
 			if err != nil {
+				// Backoff after 429s is handled host-wide by the throttle
 				fmt.Printf("  %s %d: load error - %v\n", month, year, err)
-				consecutiveErrors++
-				if consecutiveErrors >= 3 {
-					fmt.Println("multiple 429s detected — sleeping 5 minutes")
-					consecutiveErrors = 0
-					time.Sleep(5 * time.Minute)
-				}
 				continue
 			}
 
-			consecutiveErrors = 0
-
 			monthCount := 0
 			doc.Find("a[href*='/news/']").Each(func(_ int, s *goquery.Selection) {
 				href, _ := s.Attr("href")
@@ -165,7 +127,9 @@ func GetHLTVNewsIDs() ([]map[string]string, error) {
 				fmt.Printf("  %s %d: found %d articles\n", month, year, monthCount)
 			}
 
-			time.Sleep(1500 * time.Millisecond)
+			if !Replaying() {
+				time.Sleep(ArchivePageDelay)
+			}
 		}
 	}
 
@@ -194,6 +158,6 @@ func SaveArticle(article *Article, baseDir string) error {
 	}
 	defer file.Close()
 
-	_, err = fmt.Fprintf(file, "Title: %s\nURL: %s\nSource: %s\n\n%s", article.Title, article.URL, article.Source, article.Content)
+	_, err = file.WriteString(RenderText(article.Title, article.Content))
 	return err
 }
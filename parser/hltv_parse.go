@@ -2,12 +2,9 @@ package parser
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/cheggaaa/pb/v3"
 )
 
 func ParseHLTVArticleFromHTML(html string, sourceURL string) (*Article, error) {
@@ -20,88 +17,47 @@ func ParseHLTVArticleFromHTML(html string, sourceURL string) (*Article, error) {
 		return nil, err
 	}
 
+	metadata := extractMetadata(doc)
 	title := strings.TrimSpace(doc.Find("h1").First().Text())
-	var contentBuilder strings.Builder
+	headerText := strings.TrimSpace(doc.Find(".headertext").First().Text())
+
+	var paragraphs []string
 	doc.Find(".article-content p").Each(func(i int, s *goquery.Selection) {
 		text := strings.TrimSpace(s.Text())
 		if text != "" {
-			contentBuilder.WriteString(text)
-			contentBuilder.WriteString("\n\n")
+			paragraphs = append(paragraphs, text)
 		}
 	})
 
-	article := &Article{
-		ID:      "",
-		URL:     sourceURL,
-		Title:   title,
-		Content: contentBuilder.String(),
-	}
-
-	if err := IsEmptyHLTVArticle(article); err != nil {
-		return nil, err
-	}
-
-	return article, nil
-}
-
-func ProcessHLTVRawFiles(corpusDir string) error {
-	rawDir := filepath.Join(corpusDir, "hltv/raw")
-	parsedDir := filepath.Join(corpusDir, "hltv/parsed")
-
-	os.MkdirAll(parsedDir, 0755)
-
-	entries, err := os.ReadDir(rawDir)
-	if err != nil {
-		return fmt.Errorf("failed to read raw directory: %w", err)
-	}
-
-	htmlFiles := 0
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".html") {
-			htmlFiles++
+	extractor := StrategySelectors
+	if len(paragraphs) == 0 {
+		if paragraphs = ExtractMainContent(doc); len(paragraphs) > 0 {
+			extractor = StrategyReadability
 		}
 	}
 
-	if htmlFiles == 0 {
-		return fmt.Errorf("no html files found in %s", rawDir)
+	// HLTV opens every article with a bold summary paragraph
+	lead := ""
+	if headerText != "" && len(paragraphs) > 0 && paragraphs[0] == headerText {
+		lead = headerText
+		paragraphs = paragraphs[1:]
 	}
 
-	bar := pb.New(htmlFiles)
-	bar.SetTemplateString(`[{{counters . }}] {{bar . }} {{percent . }} | {{etime . }}`)
-	bar.Start()
-
-	processed := 0
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".html") {
-			continue
-		}
-
-		rawPath := filepath.Join(rawDir, entry.Name())
-		htmlBytes, err := os.ReadFile(rawPath)
-		if err != nil {
-			bar.Increment()
-			continue
-		}
-
-		html := string(htmlBytes)
-		article, err := ParseHLTVArticleFromHTML(html, "")
-		if err != nil {
-			bar.Increment()
-			continue
-		}
-
-		textFileName := strings.TrimSuffix(entry.Name(), ".html") + ".txt"
-		textPath := filepath.Join(parsedDir, textFileName)
-
-		content := fmt.Sprintf("Title: %s\n\n%s", article.Title, article.Content)
-		os.WriteFile(textPath, []byte(content), 0644)
-
-		processed++
-		bar.Increment()
+	article := &Article{
+		ID:         ArticleIDFromURL("hltv", sourceURL),
+		URL:        sourceURL,
+		Title:      title,
+		Lead:       lead,
+		Paragraphs: paragraphs,
+		Content:    joinArticleText(lead, paragraphs),
+		Source:     "hltv",
+		Metadata:   metadata,
+		Extractor:  extractor,
 	}
 
-	bar.Finish()
-	fmt.Printf("Processed: %d/%d files\n\n", processed, htmlFiles)
+	if err := IsEmptyHLTVArticle(article); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return article, nil
 }
@@ -1,15 +1,20 @@
 package parser
 
 import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
 )
 
 // InitBrowser initializes a new browser instance
@@ -48,18 +53,62 @@ func ExtractCookiesFromPage(page *rod.Page, domain string) {
 	}
 }
 
+// HTTPStatusError is returned when a page keeps answering with a non-200 status
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: status %d", e.URL, e.StatusCode)
+}
+
+// IsBlockedStatus reports whether err is a status typically sent by anti-bot walls
+func IsBlockedStatus(err error) bool {
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == http.StatusForbidden || statusErr.StatusCode == http.StatusServiceUnavailable
+}
+
+// IsChallengeHTML reports whether html is a Cloudflare challenge or another anti-bot page
+func IsChallengeHTML(html string) bool {
+	if strings.Contains(html, "challenge-form") ||
+		strings.Contains(html, "Cloudflare") ||
+		strings.Contains(html, "cf-browser-verification") {
+		return true
+	}
+	return IsBlockedHTML(html) != nil
+}
+
 // FetchPage fetches a page using either browser or HTTP client
 func FetchPage(url string) (*goquery.Document, error) {
+	if Replaying() {
+		return ActiveCassette.FetchPage(url)
+	}
+	if Hybrid != nil {
+		return Hybrid.FetchPage(url)
+	}
 	if Browser != nil {
-		return BrowserFetchPage(url)
+		doc, err := BrowserFetchPage(url)
+		if err == nil {
+			atomic.AddInt64(&fetchPaths.BrowserPages, 1)
+		}
+		return doc, err
+	}
+	doc, err := HTTPFetchPage(url)
+	if err == nil {
+		atomic.AddInt64(&fetchPaths.HTTPPages, 1)
 	}
-	return HTTPFetchPage(url)
+	return doc, err
 }
 
 // HTTPFetchPage fetches page using HTTP client
 func HTTPFetchPage(url string) (*goquery.Document, error) {
 	maxRetries := 6
 	baseDelay := 800 * time.Millisecond
+	lastStatus := 0
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		req, err := http.NewRequest("GET", url, nil)
@@ -71,7 +120,9 @@ func HTTPFetchPage(url string) (*goquery.Document, error) {
 		req.Header.Set("User-Agent", UserAgent)
 		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
 		req.Header.Set("Accept-Language", "en-US,en;q=0.5")
-		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+		// Setting Accept-Encoding by hand turns off transparent decompression,
+		// so only offer what decodeBody handles
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
 		req.Header.Set("DNT", "1")
 		req.Header.Set("Connection", "keep-alive")
 		req.Header.Set("Upgrade-Insecure-Requests", "1")
@@ -91,31 +142,58 @@ func HTTPFetchPage(url string) (*goquery.Document, error) {
 		}
 		CookiesLock.RUnlock()
 
+		throttle := Throttle.Host(req.URL.Hostname())
+		throttle.Acquire()
+		start := time.Now()
+
 		resp, err := HTTPClient.Do(req)
 		if err != nil {
+			throttle.ReleaseFailed(err)
 			SleepWithJitter(baseDelay, attempt)
 			continue
 		}
 
-		if resp.StatusCode == 429 {
+		// Cloudflare answers a challenge with 503. That is a wall for this
+		// URL, not an overloaded host: retrying would only pause every
+		// worker of the host before the browser gets to try
+		if resp.StatusCode == http.StatusServiceUnavailable && isChallengeResponse(resp) {
+			throttle.Release(0, 0, 0)
 			resp.Body.Close()
-			wait := time.Duration(2<<uint(attempt)) * time.Second
-			if wait > 60*time.Second {
-				wait = 60 * time.Second
-			}
-			wait += time.Duration(rand.Intn(500)) * time.Millisecond
-			fmt.Printf("got 429 from %s; sleeping %v (attempt %d)\n", url, wait, attempt+1)
-			time.Sleep(wait)
+			return nil, &HTTPStatusError{URL: url, StatusCode: resp.StatusCode}
+		}
+
+		retryAfter := ParseRetryAfter(resp.Header.Get("Retry-After"))
+		throttle.Release(resp.StatusCode, time.Since(start), retryAfter)
+
+		// The host-wide pause is applied by the throttle on the next Acquire,
+		// so every worker backs off instead of just this one
+		lastStatus = resp.StatusCode
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			resp.Body.Close()
+			fmt.Printf("got %d from %s (attempt %d)\n", resp.StatusCode, url, attempt+1)
 			continue
 		}
 
+		// Retrying a 403 wall only burns requests
+		if resp.StatusCode == http.StatusForbidden {
+			resp.Body.Close()
+			return nil, &HTTPStatusError{URL: url, StatusCode: resp.StatusCode}
+		}
+
 		if resp.StatusCode != http.StatusOK {
 			resp.Body.Close()
 			SleepWithJitter(baseDelay, attempt)
 			continue
 		}
 
-		doc, err := goquery.NewDocumentFromReader(resp.Body)
+		body, err := decodeBody(resp.Header.Get("Content-Encoding"), resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			SleepWithJitter(baseDelay, attempt)
+			continue
+		}
+		doc, err := goquery.NewDocumentFromReader(body)
 		resp.Body.Close()
 		if err != nil {
 			SleepWithJitter(baseDelay, attempt)
@@ -123,9 +201,7 @@ func HTTPFetchPage(url string) (*goquery.Document, error) {
 		}
 
 		html, _ := doc.Html()
-		if !strings.Contains(html, "challenge-form") &&
-			!strings.Contains(html, "Cloudflare") &&
-			!strings.Contains(html, "cf-browser-verification") {
+		if !IsChallengeHTML(html) {
 			for _, cookie := range resp.Cookies() {
 				if cookie.Name == "cf_clearance" {
 					domain := resp.Request.URL.Hostname()
@@ -140,9 +216,37 @@ func HTTPFetchPage(url string) (*goquery.Document, error) {
 		return doc, nil
 	}
 
+	if lastStatus != 0 && lastStatus != http.StatusOK {
+		return nil, &HTTPStatusError{URL: url, StatusCode: lastStatus}
+	}
 	return nil, fmt.Errorf("failed to fetch %s after %d attempts", url, maxRetries)
 }
 
+// isChallengeResponse reads up to 1 MB of an error response and reports
+// whether it is an anti-bot page
+func isChallengeResponse(resp *http.Response) bool {
+	body, err := decodeBody(resp.Header.Get("Content-Encoding"), io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false
+	}
+	data, _ := io.ReadAll(body)
+	return IsChallengeHTML(string(data))
+}
+
+// decodeBody undoes the Content-Encoding of a response body
+func decodeBody(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return flate.NewReader(body), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
 // BrowserFetchPage fetches page using browser
 func BrowserFetchPage(url string) (*goquery.Document, error) {
 	if Browser == nil {
@@ -152,6 +256,18 @@ func BrowserFetchPage(url string) (*goquery.Document, error) {
 	page := Browser.MustPage("")
 	defer page.MustClose()
 
+	// cf_clearance is bound to the user agent, so the browser must present the
+	// same one as the HTTP client for the cookies to be reusable
+	if Hybrid != nil {
+		_ = page.SetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: UserAgent})
+	}
+
+	// The browser has a controller of its own: its fixed waits would read as
+	// latency spikes and slow down the HTTP workers of the host, and it should
+	// not take their concurrency slots
+	throttle := Throttle.Host(hostOf(url) + " (browser)")
+	throttle.Acquire()
+
 	err := rod.Try(func() {
 		page.MustNavigate(url)
 		page.MustWaitLoad()
@@ -168,6 +284,8 @@ func BrowserFetchPage(url string) (*goquery.Document, error) {
 		time.Sleep(1 * time.Second)
 	})
 
+	// No latency is fed back, it is mostly the waits above
+	throttle.Release(0, 0, 0)
 	if err != nil {
 		return nil, fmt.Errorf("browser navigation failed: %w", err)
 	}
@@ -180,5 +298,9 @@ func BrowserFetchPage(url string) (*goquery.Document, error) {
 		return nil, fmt.Errorf("failed to get HTML: %w", err)
 	}
 
+	if ActiveCassette != nil {
+		ActiveCassette.RecordHTML(url, html, "browser")
+	}
+
 	return goquery.NewDocumentFromReader(strings.NewReader(html))
 }
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/go-rod/rod"
+)
+
+// FetchPathStats counts pages per fetch path. Escalations and Deescalations
+// both count hosts switching between walled and open, so they pair up; how
+// many URLs went to the browser is BrowserPages.
+type FetchPathStats struct {
+	HTTPPages     int64 `json:"http_pages"`
+	BrowserPages  int64 `json:"browser_pages"`
+	Escalations   int64 `json:"escalations"`
+	Deescalations int64 `json:"deescalations"`
+}
+
+var fetchPaths FetchPathStats
+
+// FetchPaths returns how many pages were served by each fetch path so far
+func FetchPaths() FetchPathStats {
+	return FetchPathStats{
+		HTTPPages:     atomic.LoadInt64(&fetchPaths.HTTPPages),
+		BrowserPages:  atomic.LoadInt64(&fetchPaths.BrowserPages),
+		Escalations:   atomic.LoadInt64(&fetchPaths.Escalations),
+		Deescalations: atomic.LoadInt64(&fetchPaths.Deescalations),
+	}
+}
+
+// HybridFetcher fetches every page over HTTP first and escalates only the
+// URLs that hit an anti-bot page to a lazily started browser. The clearance
+// cookies the browser obtains are reused by the HTTP client, so the next
+// pages of the host usually pass over HTTP again; the host counts as
+// de-escalated on the first HTTP page that gets through after a wall.
+type HybridFetcher struct {
+	show  bool
+	debug bool
+
+	mu         sync.Mutex
+	walled     map[string]bool
+	browserErr error
+
+	// browser fetches an escalated URL; tests replace it
+	browser func(url string) (*goquery.Document, error)
+}
+
+func NewHybridFetcher(show, debug bool) *HybridFetcher {
+	h := &HybridFetcher{
+		show:   show,
+		debug:  debug,
+		walled: make(map[string]bool),
+	}
+	h.browser = h.browserFetch
+	return h
+}
+
+// StartBrowser launches the shared browser if it isn't running yet
+func (h *HybridFetcher) StartBrowser() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if Browser != nil {
+		return nil
+	}
+	if h.browserErr != nil {
+		return h.browserErr
+	}
+
+	fmt.Println("[hybrid] Starting browser for anti-bot pages...")
+	err := rod.Try(func() {
+		Browser, h.browserErr = InitBrowser(h.show, h.debug)
+	})
+	if err != nil {
+		h.browserErr = err
+	}
+	if h.browserErr != nil {
+		Browser = nil
+		h.browserErr = fmt.Errorf("failed to start browser: %w", h.browserErr)
+	}
+	return h.browserErr
+}
+
+func (h *HybridFetcher) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if Browser != nil {
+		Browser.MustClose()
+		Browser = nil
+	}
+}
+
+func (h *HybridFetcher) FetchPage(url string) (*goquery.Document, error) {
+	host := hostOf(url)
+
+	doc, err := HTTPFetchPage(url)
+	if err == nil {
+		html, _ := doc.Html()
+		if !IsChallengeHTML(html) {
+			h.deescalate(host)
+			atomic.AddInt64(&fetchPaths.HTTPPages, 1)
+			return doc, nil
+		}
+	} else if !IsBlockedStatus(err) {
+		return nil, err
+	}
+
+	h.escalate(host, url)
+	doc, err = h.browser(url)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&fetchPaths.BrowserPages, 1)
+	return doc, nil
+}
+
+func (h *HybridFetcher) browserFetch(url string) (*goquery.Document, error) {
+	if err := h.StartBrowser(); err != nil {
+		return nil, err
+	}
+	return BrowserFetchPage(url)
+}
+
+// escalate marks the host as walled the first time one of its URLs has to
+// go to the browser
+func (h *HybridFetcher) escalate(host, url string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.walled[host] {
+		return
+	}
+	h.walled[host] = true
+	atomic.AddInt64(&fetchPaths.Escalations, 1)
+	fmt.Printf("[hybrid] %s: anti-bot page over HTTP, escalating %s to browser\n", host, url)
+}
+
+func (h *HybridFetcher) deescalate(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.walled[host] {
+		return
+	}
+	delete(h.walled, host)
+	atomic.AddInt64(&fetchPaths.Deescalations, 1)
+	fmt.Printf("[hybrid] %s: HTTP works again, de-escalating\n", host)
+}
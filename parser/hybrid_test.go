@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const challengePage = `<html><body><form id="challenge-form">Checking your browser</form></body></html>`
+
+func TestHybridEscalation(t *testing.T) {
+	var requests int64
+	walled := int32(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if atomic.LoadInt32(&walled) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(challengePage))
+			return
+		}
+		w.Write([]byte("<html><body><h1>" + r.URL.Path + "</h1></body></html>"))
+	}))
+	defer srv.Close()
+
+	oldThrottle := Throttle
+	defer func() { Throttle = oldThrottle }()
+	Throttle = NewThrottleController(ThrottleConfig{InitialRate: 1000, MaxRate: 1000})
+
+	var browsed []string
+	h := NewHybridFetcher(false, false)
+	h.browser = func(url string) (*goquery.Document, error) {
+		browsed = append(browsed, url)
+		return goquery.NewDocumentFromReader(strings.NewReader("<html><body>from browser</body></html>"))
+	}
+
+	before := FetchPaths()
+	fetch := func(path string) string {
+		t.Helper()
+		doc, err := h.FetchPage(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc.Find("body").Text()
+	}
+
+	start := time.Now()
+	if got := fetch("/a"); got != "from browser" {
+		t.Errorf("walled /a served %q, want the browser page", got)
+	}
+	fetch("/b")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("two walled URLs took %v; the challenge 503 must not be retried", elapsed)
+	}
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("%d HTTP requests for two walled URLs, want one each", n)
+	}
+	if st := Throttle.Host(hostOf(srv.URL)).Stats(); st.Throttled != 0 || st.Decreases != 0 {
+		t.Errorf("challenge pages throttled the host: %+v", st)
+	}
+
+	atomic.StoreInt32(&walled, 0)
+	if got := fetch("/c"); got != "/c" {
+		t.Errorf("open /c served %q over HTTP", got)
+	}
+	fetch("/d")
+
+	after := FetchPaths()
+	if len(browsed) != 2 || after.BrowserPages-before.BrowserPages != 2 || after.HTTPPages-before.HTTPPages != 2 {
+		t.Errorf("browser got %v; %d browser and %d HTTP pages, want 2 each",
+			browsed, after.BrowserPages-before.BrowserPages, after.HTTPPages-before.HTTPPages)
+	}
+	// Both counters count the host switching, once each way
+	if after.Escalations-before.Escalations != 1 || after.Deescalations-before.Deescalations != 1 {
+		t.Errorf("%d escalations and %d de-escalations, want 1 each",
+			after.Escalations-before.Escalations, after.Deescalations-before.Deescalations)
+	}
+}
@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultManifestPath is where the integer doc id manifest is kept
+const DefaultManifestPath = "corpus/manifest.tsv"
+
+var manifestHeader = []string{"docid", "doc_key", "source", "url", "title", "parsed_path", "hash"}
+
+// ManifestEntry ties a persistent integer doc id to an article. The integer
+// ids are what the BOOLEAN_INDEX files of the C++ tools contain.
+type ManifestEntry struct {
+	ID         int
+	DocKey     string
+	Source     string
+	URL        string
+	Title      string
+	ParsedPath string
+	Hash       string
+}
+
+// Manifest assigns integer doc ids per URL. Ids are never reused or
+// reassigned: a URL keeps its id across re-crawls, new URLs get the next free
+// id.
+type Manifest struct {
+	path    string
+	entries []*ManifestEntry
+	byURL   map[string]*ManifestEntry
+	byID    map[int]*ManifestEntry
+	nextID  int
+}
+
+// LoadManifest reads the manifest at path; a missing file gives an empty one
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{path: path, byURL: make(map[string]*ManifestEntry), byID: make(map[int]*ManifestEntry)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if line == 1 {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != len(manifestHeader) {
+			return nil, fmt.Errorf("%s:%d: expected %d columns, got %d", path, line, len(manifestHeader), len(fields))
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad docid: %w", path, line, err)
+		}
+		m.add(&ManifestEntry{
+			ID:         id,
+			DocKey:     fields[1],
+			Source:     fields[2],
+			URL:        fields[3],
+			Title:      fields[4],
+			ParsedPath: fields[5],
+			Hash:       fields[6],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manifest) add(e *ManifestEntry) {
+	m.entries = append(m.entries, e)
+	m.byURL[e.URL] = e
+	m.byID[e.ID] = e
+	if e.ID >= m.nextID {
+		m.nextID = e.ID + 1
+	}
+}
+
+// Assign returns the entry of url, creating one with the next free id
+func (m *Manifest) Assign(url string) *ManifestEntry {
+	if e, ok := m.byURL[url]; ok {
+		return e
+	}
+	e := &ManifestEntry{ID: m.nextID, URL: url}
+	m.add(e)
+	return e
+}
+
+// Record assigns the id of a parsed article and fills its entry from it
+func (m *Manifest) Record(r *ParsedRecord) *ManifestEntry {
+	e := m.Assign(r.URL)
+	e.DocKey = r.DocID
+	e.Source = r.Source
+	e.Title = r.Title
+	e.Hash = r.RawHash
+	return e
+}
+
+// Lookup returns the entry with the given integer id, or nil
+func (m *Manifest) Lookup(id int) *ManifestEntry {
+	return m.byID[id]
+}
+
+// ByURL returns the entry of url, or nil
+func (m *Manifest) ByURL(url string) *ManifestEntry {
+	return m.byURL[url]
+}
+
+// Len returns the number of ids handed out so far, which is one past the
+// highest id
+func (m *Manifest) Len() int {
+	return m.nextID
+}
+
+// Save writes the manifest sorted by id
+func (m *Manifest) Save() error {
+	sort.Slice(m.entries, func(i, j int) bool { return m.entries[i].ID < m.entries[j].ID })
+
+	if dir := filepath.Dir(m.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := m.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, strings.Join(manifestHeader, "\t"))
+	for _, e := range m.entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID, e.DocKey, e.Source, e.URL, manifestField(e.Title), e.ParsedPath, e.Hash)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+func manifestField(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// IndexedFileName is the file name the indexed export gives a doc id. Names
+// are zero-padded so that sorting them sorts by id.
+func IndexedFileName(id int) string {
+	return fmt.Sprintf("%08d.txt", id)
+}
+
+// ManifestRecorder is a ParsedListener that gives articles their doc id as
+// soon as they are saved, so search results have ids before the next indexed
+// export. The file is read and written per batch so an export running in
+// between is not overwritten. Dropped articles keep their ids.
+type ManifestRecorder struct {
+	Path string
+
+	mu sync.Mutex
+	// pending holds records not recorded yet because the manifest could not
+	// be read or written, for the next call; new ids follow save order
+	pending []*ParsedRecord
+}
+
+func NewManifestRecorder(path string) *ManifestRecorder {
+	return &ManifestRecorder{Path: path}
+}
+
+func (r *ManifestRecorder) ParsedChanged(records []*ParsedRecord, _ []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, records...)
+	if len(r.pending) == 0 {
+		return
+	}
+
+	m, err := LoadManifest(r.Path)
+	if err != nil {
+		fmt.Printf("[manifest] Failed to load %s, will retry: %v\n", r.Path, err)
+		return
+	}
+	before := m.Len()
+	for _, rec := range r.pending {
+		m.Record(rec)
+	}
+	if err := m.Save(); err != nil {
+		fmt.Printf("[manifest] Failed to save %s, will retry: %v\n", r.Path, err)
+		return
+	}
+	r.pending = nil
+	if m.Len() > before {
+		fmt.Printf("[manifest] %d new doc ids, %d in total\n", m.Len()-before, m.Len())
+	}
+}
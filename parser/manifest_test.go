@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Saved articles get their doc ids in save order and keep them when saved
+// again or dropped; a manifest that cannot be written is retried
+func TestManifestRecorder(t *testing.T) {
+	const a, b, c = "https://www.hltv.org/news/1/a", "https://www.hltv.org/news/2/b", "https://www.hltv.org/news/3/c"
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "docs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.tsv")
+	w := NewBatchWriter(bolt, 100, 0)
+	w.AddListener(NewManifestRecorder(path))
+
+	w.SaveParsed(&ParsedRecord{DocID: "hltv-2", URL: b, Source: "hltv", Title: "B", RawHash: "hb"})
+	w.SaveParsed(&ParsedRecord{DocID: "hltv-1", URL: a, Source: "hltv", Title: "A", RawHash: "ha"})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.DropParsed(b)
+	w.SaveParsed(&ParsedRecord{DocID: "hltv-1", URL: a, Source: "hltv", Title: "A2", RawHash: "ha2"})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in place of the temporary file makes the save fail
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	w.SaveParsed(&ParsedRecord{DocID: "hltv-3", URL: c, Source: "hltv", Title: "C"})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := LoadManifest(path); m.ByURL(c) != nil {
+		t.Fatal("manifest saved through a blocked temporary file")
+	}
+	if err := os.Remove(path + ".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	// The next batch, here a lone drop, records c as well
+	w.DropParsed(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url   string
+		id    int
+		key   string
+		title string
+	}{
+		{b, 0, "hltv-2", "B"},
+		{a, 1, "hltv-1", "A2"},
+		{c, 2, "hltv-3", "C"},
+	}
+	for _, tt := range tests {
+		e := m.ByURL(tt.url)
+		if e == nil {
+			t.Errorf("%s has no doc id", tt.url)
+			continue
+		}
+		if e.ID != tt.id || e.DocKey != tt.key || e.Title != tt.title {
+			t.Errorf("%s recorded as %d %s %q, want %d %s %q", tt.url, e.ID, e.DocKey, e.Title, tt.id, tt.key, tt.title)
+		}
+	}
+	if m.Len() != 3 {
+		t.Errorf("%d doc ids handed out, want 3", m.Len())
+	}
+}
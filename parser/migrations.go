@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one step of the documents collection schema. Steps run in
+// version order and must be safe to re-run after a partial failure.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db *MongoStore) error
+}
+
+type appliedMigration struct {
+	Version   int    `bson:"version"`
+	Name      string `bson:"name"`
+	AppliedAt int64  `bson:"applied_at"`
+}
+
+type schemaRecord struct {
+	ID      string             `bson:"_id"`
+	Version int                `bson:"version"`
+	Applied []appliedMigration `bson:"applied"`
+}
+
+// Migrator is implemented by stores with a versioned schema
+type Migrator interface {
+	SchemaVersion() (int, error)
+	Migrate() ([]Migration, error)
+}
+
+var mongoMigrations = []Migration{
+	{1, "unique url index", migrateURLIndex},
+	{2, "secondary indexes", migrateSecondaryIndexes},
+	{3, "backfill source, html_hash, last_checked and versions", migrateBackfill},
+	{4, "parsed articles indexes", migrateParsedIndexes},
+}
+
+// LatestSchemaVersion is the schema version a fully migrated store has
+func LatestSchemaVersion() int {
+	return mongoMigrations[len(mongoMigrations)-1].Version
+}
+
+func (db *MongoStore) SchemaVersion() (int, error) {
+	var schema schemaRecord
+	err := db.metadata.FindOne(db.ctx, bson.M{"_id": db.schemaID}).Decode(&schema)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return schema.Version, nil
+}
+
+// Migrate applies every migration newer than the recorded schema version and
+// returns the ones it applied. The version is recorded after each step, so
+// a failed run resumes at the failed step.
+func (db *MongoStore) Migrate() ([]Migration, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	var applied []Migration
+	for _, m := range mongoMigrations {
+		if m.Version <= current {
+			continue
+		}
+
+		fmt.Printf("[migrate] %d: %s\n", m.Version, m.Name)
+		if err := m.Up(db); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+
+		update := bson.M{
+			"$set":  bson.M{"version": m.Version},
+			"$push": bson.M{"applied": appliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().Unix()}},
+		}
+		_, err := db.metadata.UpdateOne(db.ctx, bson.M{"_id": db.schemaID}, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return applied, fmt.Errorf("failed to record schema version %d: %w", m.Version, err)
+		}
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+func migrateURLIndex(db *MongoStore) error {
+	_, err := db.collection.Indexes().CreateOne(db.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "url", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func migrateSecondaryIndexes(db *MongoStore) error {
+	_, err := db.collection.Indexes().CreateMany(db.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "source", Value: 1}}},
+		{Keys: bson.D{{Key: "last_checked", Value: 1}}},
+		{Keys: bson.D{{Key: "crawl_time", Value: -1}}},
+		{Keys: bson.D{{Key: "html_hash", Value: 1}}},
+	})
+	return err
+}
+
+func migrateParsedIndexes(db *MongoStore) error {
+	_, err := db.parsed.Indexes().CreateMany(db.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "url", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "doc_id", Value: 1}}},
+		{Keys: bson.D{{Key: "source", Value: 1}}},
+	})
+	return err
+}
+
+// migrateBackfill fills fields that documents written by older versions of
+// the crawler lack
+func migrateBackfill(db *MongoStore) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"source": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"html_hash": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"last_checked": bson.M{"$exists": false}},
+		bson.M{"versions": bson.M{"$exists": false}},
+	}}
+
+	cursor, err := db.collection.Find(db.ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(db.ctx)
+
+	updated := 0
+	for cursor.Next(db.ctx) {
+		var doc Document
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		set := bson.M{}
+		if doc.Source == "" {
+			if source := sourceFromURL(doc.URL); source != "" {
+				set["source"] = source
+			}
+		}
+		if doc.HTMLHash == "" {
+			doc.HTMLHash = computeHTMLHash(doc.RawHTML)
+			set["html_hash"] = doc.HTMLHash
+		}
+		if doc.LastChecked == 0 {
+			set["last_checked"] = doc.CrawlTime
+		}
+		if len(doc.Versions) == 0 && doc.RawHTML != "" {
+			if err := db.putRaw(doc.HTMLHash, doc.RawHTML); err != nil {
+				return err
+			}
+			set["versions"] = DocumentVersions(&doc)
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		if _, err := db.collection.UpdateOne(db.ctx, bson.M{"_id": doc.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		updated++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("[migrate] backfilled %d documents\n", updated)
+	return nil
+}
+
+func sourceFromURL(url string) string {
+	switch {
+	case strings.Contains(url, hostOf(HLTVBaseURL)):
+		return "hltv"
+	case strings.Contains(url, hostOf(CybersportBaseURL)):
+		return "cybersport"
+	}
+	return ""
+}
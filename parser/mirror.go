@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type mirrorLink struct {
+	id   string
+	slug string
+}
+
+// Mirror serves an existing corpus/<site>/raw tree at the paths of the live
+// sites, plus synthetic HLTV archive pages and Cybersport tag feeds, so a
+// full crawl can be pointed at it for staging and load tests
+type Mirror struct {
+	CorpusDir string
+	Delay     time.Duration
+
+	hltvArchive map[string][]mirrorLink
+	hltvPages   map[string]string
+	csTags      map[string][]string
+	csPages     map[string]string
+}
+
+var (
+	hltvDateRe     = regexp.MustCompile(`data-unix="(\d+)"`)
+	mirrorArticle  = regexp.MustCompile(`^/news/(\d+)(?:/[^/]*)?/?$`)
+	mirrorArchive  = regexp.MustCompile(`^/news/archive/(\d{4})/([a-z]+)/?$`)
+	mirrorTagFeed  = regexp.MustCompile(`^/tags/([^/]+)/?$`)
+	mirrorTagEntry = regexp.MustCompile(`^/tags/([^/]+)/([^/]+)/?$`)
+)
+
+var archiveMonths = []string{
+	"january", "february", "march", "april",
+	"may", "june", "july", "august",
+	"september", "october", "november", "december",
+}
+
+func NewMirror(corpusDir string, sites []string) (*Mirror, error) {
+	m := &Mirror{
+		CorpusDir:   corpusDir,
+		hltvArchive: make(map[string][]mirrorLink),
+		hltvPages:   make(map[string]string),
+		csTags:      make(map[string][]string),
+		csPages:     make(map[string]string),
+	}
+
+	for _, site := range sites {
+		var err error
+		switch site {
+		case "hltv":
+			err = m.loadHLTV()
+		case "cybersport":
+			err = m.loadCybersport()
+		default:
+			err = fmt.Errorf("unknown site: %s", site)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Mirror) loadHLTV() error {
+	rawDir := filepath.Join(m.CorpusDir, "hltv/raw")
+	entries, err := os.ReadDir(rawDir)
+	if err != nil {
+		return fmt.Errorf("failed to read raw directory: %w", err)
+	}
+
+	slugs := make(map[string]string)
+	if links, err := ReadHLTVCSV(filepath.Join(m.CorpusDir, "hltv_links.csv")); err == nil {
+		for _, l := range links {
+			slugs[l["id"]] = l["slug"]
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".html") {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".html")
+		path := filepath.Join(rawDir, entry.Name())
+
+		slug := slugs[id]
+		if slug == "" {
+			slug = "article"
+		}
+
+		published := publishedTime(path)
+		key := archiveKey(published.Year(), archiveMonths[published.Month()-1])
+
+		m.hltvPages[id] = path
+		m.hltvArchive[key] = append(m.hltvArchive[key], mirrorLink{id: id, slug: slug})
+	}
+
+	fmt.Printf("Mirror: %d HLTV pages in %d archive months\n", len(m.hltvPages), len(m.hltvArchive))
+	return nil
+}
+
+func (m *Mirror) loadCybersport() error {
+	rawDir := filepath.Join(m.CorpusDir, "cybersport/raw")
+	entries, err := os.ReadDir(rawDir)
+	if err != nil {
+		return fmt.Errorf("failed to read raw directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".html") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".html")
+		parts := strings.SplitN(name, "__", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		tag, slug := parts[0], parts[1]
+
+		m.csPages[tag+"/"+slug] = filepath.Join(rawDir, entry.Name())
+		m.csTags[tag] = append(m.csTags[tag], slug)
+	}
+
+	for tag := range m.csTags {
+		sort.Strings(m.csTags[tag])
+	}
+
+	fmt.Printf("Mirror: %d Cybersport pages in %d tags\n", len(m.csPages), len(m.csTags))
+	return nil
+}
+
+// publishedTime reads the publication date HLTV embeds in the article page,
+// falling back to the file modification time
+func publishedTime(path string) time.Time {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if match := hltvDateRe.FindSubmatch(data); match != nil {
+			if ms, err := strconv.ParseInt(string(match[1]), 10, 64); err == nil {
+				return time.UnixMilli(ms)
+			}
+		}
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+func archiveKey(year int, month string) string {
+	return fmt.Sprintf("%d/%s", year, month)
+}
+
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.Delay > 0 {
+		time.Sleep(m.Delay)
+	}
+
+	path := r.URL.Path
+
+	if match := mirrorArchive.FindStringSubmatch(path); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		var links []string
+		for _, l := range m.hltvArchive[archiveKey(year, match[2])] {
+			links = append(links, fmt.Sprintf("/news/%s/%s", l.id, l.slug))
+		}
+		writeListing(w, fmt.Sprintf("News archive %s %d", match[2], year), links)
+		return
+	}
+
+	if match := mirrorArticle.FindStringSubmatch(path); match != nil {
+		if p, ok := m.hltvPages[match[1]]; ok {
+			serveRawPage(w, p)
+			return
+		}
+	}
+
+	if match := mirrorTagFeed.FindStringSubmatch(path); match != nil {
+		tag := match[1]
+		if slugs, ok := m.csTags[tag]; ok {
+			var links []string
+			for _, slug := range slugs {
+				links = append(links, fmt.Sprintf("/tags/%s/%s", tag, slug))
+			}
+			writeListing(w, "Tag "+tag, links)
+			return
+		}
+	}
+
+	if match := mirrorTagEntry.FindStringSubmatch(path); match != nil {
+		if p, ok := m.csPages[match[1]+"/"+match[2]]; ok {
+			serveRawPage(w, p)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func serveRawPage(w http.ResponseWriter, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+func writeListing(w http.ResponseWriter, title string, links []string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%s</title></head><body>\n<h1>%s</h1>\n", html.EscapeString(title), html.EscapeString(title))
+	for _, l := range links {
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a><br>\n", html.EscapeString(l), html.EscapeString(l))
+	}
+	fmt.Fprint(w, "</body></html>\n")
+}
@@ -0,0 +1,344 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// ExtractorVersion must be bumped whenever extractor output changes, so the
+// next incremental parse redoes every file
+const ExtractorVersion = 2
+
+const parseStateFile = ".parse_state.json"
+
+// Parse outcomes recorded per raw file
+const (
+	ParseParsed = "parsed"
+	ParseEmpty  = "empty"
+	ParseFailed = "failed"
+)
+
+type ParseOptions struct {
+	Workers int
+	Force   bool
+}
+
+type ParseFailure struct {
+	File   string
+	Status string
+	Reason string
+}
+
+type ParseSummary struct {
+	Source     string
+	Total      int
+	Parsed     int
+	Skipped    int
+	Failed     int
+	Empty      int
+	Records    int
+	Strategies map[string]int
+	Reasons    map[string]int
+	Failures   []ParseFailure
+}
+
+type parsedFileState struct {
+	Hash             string `json:"hash"`
+	ExtractorVersion int    `json:"extractor_version"`
+	Status           string `json:"status"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+type parseResult struct {
+	file      string
+	state     parsedFileState
+	extractor string
+	record    *ParsedRecord
+}
+
+var reasonDetails = regexp.MustCompile(`\s*\([^)]*\)`)
+
+// ProcessRawFiles parses corpus/<source>/raw into JSONL records in
+// corpus/<source>/jsonl and their plain-text views in corpus/<source>/parsed,
+// using a worker pool. Unless opts.Force is set, files whose hash and
+// extractor version match the previous run are skipped.
+func ProcessRawFiles(corpusDir, source string, opts ParseOptions) (*ParseSummary, error) {
+	if source != "hltv" && source != "cybersport" {
+		return nil, fmt.Errorf("unknown source: %s", source)
+	}
+
+	rawDir := filepath.Join(corpusDir, source, "raw")
+	parsedDir := filepath.Join(corpusDir, source, "parsed")
+	os.MkdirAll(parsedDir, 0755)
+
+	entries, err := os.ReadDir(rawDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw directory: %w", err)
+	}
+
+	var targets []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".html") {
+			targets = append(targets, entry.Name())
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no html files found in %s", rawDir)
+	}
+
+	statePath := filepath.Join(parsedDir, parseStateFile)
+	state := loadParseState(statePath)
+
+	jsonlDir := JSONLDir(corpusDir, source)
+	records, err := ReadRecords(jsonlDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parsed records: %w", err)
+	}
+
+	job := parseJob{
+		rawDir:    rawDir,
+		parsedDir: parsedDir,
+		source:    source,
+		force:     opts.Force,
+		records:   records,
+		hltvSlugs: LoadHLTVSlugs(corpusDir),
+	}
+
+	summary := &ParseSummary{
+		Source:     source,
+		Total:      len(targets),
+		Strategies: make(map[string]int),
+		Reasons:    make(map[string]int),
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	bar := pb.New(len(targets))
+	bar.SetTemplateString(`[{{counters . }}] {{bar . }} {{percent . }} | {{etime . }}`)
+	bar.Start()
+
+	jobs := make(chan string)
+	results := make(chan parseResult)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				results <- job.parseRawFile(name, state[name])
+			}
+		}()
+	}
+
+	go func() {
+		for _, name := range targets {
+			jobs <- name
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	newState := make(map[string]parsedFileState, len(targets))
+	updated := make(map[string]*ParsedRecord)
+	for res := range results {
+		bar.Increment()
+
+		if res.state.Status == "" {
+			summary.Skipped++
+			newState[res.file] = state[res.file]
+			continue
+		}
+		newState[res.file] = res.state
+		updated[DocID(source, res.file)] = res.record
+
+		switch res.state.Status {
+		case ParseParsed:
+			summary.Parsed++
+			summary.Strategies[res.extractor]++
+		case ParseEmpty, ParseFailed:
+			if res.state.Status == ParseEmpty {
+				summary.Empty++
+			} else {
+				summary.Failed++
+			}
+			summary.Reasons[reasonDetails.ReplaceAllString(res.state.Reason, "")]++
+			summary.Failures = append(summary.Failures, ParseFailure{
+				File:   res.file,
+				Status: res.state.Status,
+				Reason: res.state.Reason,
+			})
+		}
+	}
+
+	bar.Finish()
+
+	sort.Slice(summary.Failures, func(i, j int) bool { return summary.Failures[i].File < summary.Failures[j].File })
+
+	// Records of raw files that were removed or no longer parse are dropped
+	present := make(map[string]bool, len(targets))
+	for _, name := range targets {
+		present[DocID(source, name)] = true
+	}
+	for id := range records {
+		if !present[id] {
+			delete(records, id)
+		}
+	}
+	for id, record := range updated {
+		if record == nil {
+			delete(records, id)
+		} else {
+			records[id] = record
+		}
+	}
+	summary.Records = len(records)
+
+	if err := WriteRecords(jsonlDir, records); err != nil {
+		return summary, fmt.Errorf("failed to write parsed records: %w", err)
+	}
+
+	if err := saveParseState(statePath, newState); err != nil {
+		return summary, fmt.Errorf("failed to save parse state: %w", err)
+	}
+
+	return summary, nil
+}
+
+type parseJob struct {
+	rawDir    string
+	parsedDir string
+	source    string
+	force     bool
+	records   map[string]*ParsedRecord
+	hltvSlugs map[string]string
+}
+
+// parseRawFile parses one raw file. A zero state status means the file was
+// skipped as unchanged.
+func (j *parseJob) parseRawFile(name string, prev parsedFileState) parseResult {
+	res := parseResult{file: name}
+	docID := DocID(j.source, name)
+
+	htmlBytes, err := os.ReadFile(filepath.Join(j.rawDir, name))
+	if err != nil {
+		res.state = parsedFileState{Status: ParseFailed, Reason: fmt.Sprintf("read error: %v", err)}
+		return res
+	}
+	html := string(htmlBytes)
+
+	hash := computeHTMLHash(html)
+	textPath := filepath.Join(j.parsedDir, strings.TrimSuffix(name, ".html")+".txt")
+
+	if !j.force && prev.Hash == hash && prev.ExtractorVersion == ExtractorVersion {
+		if prev.Status != ParseParsed {
+			return res
+		}
+		_, statErr := os.Stat(textPath)
+		if _, ok := j.records[docID]; ok && statErr == nil {
+			return res
+		}
+	}
+
+	res.state = parsedFileState{Hash: hash, ExtractorVersion: ExtractorVersion}
+
+	sourceURL := RecoverSourceURL(j.source, name, html, j.hltvSlugs)
+	article, err := ParseArticleFromHTML(j.source, html, sourceURL)
+	if err != nil {
+		var empty *EmptyArticleError
+		if errors.As(err, &empty) {
+			res.state.Status = ParseEmpty
+		} else {
+			res.state.Status = ParseFailed
+		}
+		res.state.Reason = err.Error()
+		os.Remove(textPath)
+		return res
+	}
+
+	record := NewParsedRecord(docID, article, hash)
+	if err := os.WriteFile(textPath, []byte(RenderText(record.Title, record.Body())), 0644); err != nil {
+		res.state.Status = ParseFailed
+		res.state.Reason = fmt.Sprintf("write error: %v", err)
+		return res
+	}
+
+	res.state.Status = ParseParsed
+	res.extractor = article.Extractor
+	res.record = record
+	return res
+}
+
+func loadParseState(path string) map[string]parsedFileState {
+	state := make(map[string]parsedFileState)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		fmt.Printf("Ignoring unreadable parse state %s: %v\n", path, err)
+		return make(map[string]parsedFileState)
+	}
+	return state
+}
+
+func saveParseState(path string, state map[string]parsedFileState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func PrintParseSummary(summary *ParseSummary) {
+	fmt.Printf("\nParse Summary: %s\n", strings.ToUpper(summary.Source))
+	fmt.Printf("=====================================\n")
+	fmt.Printf("Total files:     %d\n", summary.Total)
+	fmt.Printf("Parsed:          %d (selectors: %d, readability: %d)\n",
+		summary.Parsed, summary.Strategies[StrategySelectors], summary.Strategies[StrategyReadability])
+	fmt.Printf("Skipped:         %d (unchanged)\n", summary.Skipped)
+	fmt.Printf("Empty output:    %d\n", summary.Empty)
+	fmt.Printf("Failed:          %d\n", summary.Failed)
+	fmt.Printf("Records:         %d\n", summary.Records)
+
+	if len(summary.Reasons) > 0 {
+		reasons := make([]string, 0, len(summary.Reasons))
+		for r := range summary.Reasons {
+			reasons = append(reasons, r)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return summary.Reasons[reasons[i]] > summary.Reasons[reasons[j]] })
+
+		fmt.Printf("\nReasons:\n")
+		for _, r := range reasons {
+			fmt.Printf("  %-30s %d\n", r, summary.Reasons[r])
+		}
+
+		fmt.Printf("\nFiles:\n")
+		for i, f := range summary.Failures {
+			if i == 20 {
+				fmt.Printf("  ... and %d more\n", len(summary.Failures)-20)
+				break
+			}
+			fmt.Printf("  [%s] %s: %s\n", f.Status, f.File, f.Reason)
+		}
+	}
+	fmt.Printf("=====================================\n\n")
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Extraction strategies reported in Article.Extractor
+const (
+	StrategySelectors   = "selectors"
+	StrategyReadability = "readability"
+)
+
+var (
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|main|news|post|story|text`)
+	negativeHint = regexp.MustCompile(`(?i)banner|comment|cookie|footer|forum|menu|meta|nav|promo|related|share|sidebar|social|sponsor|subscribe|widget`)
+)
+
+// ExtractMainContent finds the node that most likely holds the article text
+// in arbitrary HTML and returns its paragraphs. Nodes are scored by the
+// amount of text and commas in their paragraphs, class/id hints and link
+// density, in the spirit of Readability. The document is modified: scripts,
+// navigation and other boilerplate are removed.
+func ExtractMainContent(doc *goquery.Document) []string {
+	root := doc.Find("body")
+	if root.Length() == 0 {
+		root = doc.Selection
+	}
+	root.Find("script, style, noscript, iframe, form, svg, nav, header, footer, aside").Remove()
+
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 {
+			return
+		}
+		node := s.Get(0)
+		if node.Type != html.ElementNode || node.Data == "body" || node.Data == "html" {
+			return
+		}
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(s)
+			order = append(order, node)
+		}
+		scores[node] += score
+	}
+
+	root.Find("p, pre, blockquote, td").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(length)/100, 3)
+		parent := s.Parent()
+		addScore(parent, score)
+		addScore(parent.Parent(), score/2)
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for _, node := range order {
+		s := doc.FindNodes(node)
+		score := scores[node] * (1 - linkDensity(s))
+		if best == nil || score > bestScore {
+			best = s
+			bestScore = score
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	var paragraphs []string
+	blocks := "p, pre, blockquote, li"
+	best.Find(blocks).Each(func(_ int, s *goquery.Selection) {
+		if s.ParentsUntilSelection(best).Filter(blocks).Length() > 0 {
+			return
+		}
+		text := strings.TrimSpace(s.Text())
+		if utf8.RuneCountInString(text) < 15 || linkDensity(s) > 0.5 {
+			return
+		}
+		if goquery.NodeName(s) == "blockquote" {
+			text = "> " + text
+		}
+		paragraphs = append(paragraphs, text)
+	})
+
+	if len(paragraphs) == 0 {
+		for _, line := range strings.Split(best.Text(), "\n") {
+			line = strings.TrimSpace(line)
+			if utf8.RuneCountInString(line) >= 15 {
+				paragraphs = append(paragraphs, line)
+			}
+		}
+	}
+
+	return paragraphs
+}
+
+func initialScore(s *goquery.Selection) float64 {
+	score := 0.0
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		score += 10
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+
+	hints := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+	if negativeHint.MatchString(hints) {
+		score -= 25
+	}
+	if positiveHint.MatchString(hints) {
+		score += 25
+	}
+	return score
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	total := utf8.RuneCountInString(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += utf8.RuneCountInString(strings.TrimSpace(a.Text()))
+	})
+	return float64(links) / float64(total)
+}
+
+func joinParagraphs(paragraphs []string) string {
+	return strings.Join(paragraphs, "\n\n")
+}
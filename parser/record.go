@@ -0,0 +1,338 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// RecordsPerShard caps the number of records in one JSONL shard
+const RecordsPerShard = 10000
+
+// ArticleMetadata holds what the article page says about itself
+type ArticleMetadata struct {
+	Published string   `json:"published,omitempty" bson:"published,omitempty"`
+	Author    string   `json:"author,omitempty" bson:"author,omitempty"`
+	Canonical string   `json:"canonical,omitempty" bson:"canonical,omitempty"`
+	Tags      []string `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+// ParsedRecord is the canonical parsed form of one article. Records are
+// stored as JSONL shards in corpus/<source>/jsonl and in the parsed articles
+// of the document store; every other parsed view is derived from them.
+type ParsedRecord struct {
+	DocID            string          `json:"doc_id" bson:"doc_id"`
+	Source           string          `json:"source" bson:"source"`
+	URL              string          `json:"url" bson:"url"`
+	Title            string          `json:"title" bson:"title"`
+	Lead             string          `json:"lead,omitempty" bson:"lead,omitempty"`
+	Paragraphs       []string        `json:"paragraphs" bson:"paragraphs"`
+	Metadata         ArticleMetadata `json:"metadata" bson:"metadata"`
+	Extractor        string          `json:"extractor" bson:"extractor"`
+	ExtractorVersion int             `json:"extractor_version" bson:"extractor_version"`
+	RawHash          string          `json:"raw_hash" bson:"raw_hash"`
+	ParsedAt         time.Time       `json:"parsed_at" bson:"parsed_at"`
+}
+
+var (
+	hltvURLRe       = regexp.MustCompile(`/news/(\d+)(?:/([^/?#]+))?`)
+	cybersportURLRe = regexp.MustCompile(`/tags/([^/?#]+)/([^/?#]+)`)
+	canonicalRe     = regexp.MustCompile(`<link[^>]+rel="canonical"[^>]+href="([^"]+)"`)
+)
+
+// DocID returns the corpus-wide document id: the source followed by the raw
+// file name, e.g. hltv-38123 or cybersport-cs2__some-slug
+func DocID(source, rawName string) string {
+	return source + "-" + strings.TrimSuffix(rawName, ".html")
+}
+
+// ArticleDocID returns the document id of an article fetched by the crawler
+func ArticleDocID(article *Article) string {
+	if article.Source == "cybersport" {
+		return DocID(article.Source, article.Tag+"__"+article.ID)
+	}
+	return DocID(article.Source, article.ID)
+}
+
+// DocIDFromURL returns the document id of an article URL, matching the id
+// the raw file of that URL gets
+func DocIDFromURL(source, url string) string {
+	if source == "cybersport" {
+		if m := cybersportURLRe.FindStringSubmatch(url); m != nil {
+			return DocID(source, SanitizeFilename(m[1]+"__"+m[2]))
+		}
+	}
+	return DocID(source, SanitizeFilename(ArticleIDFromURL(source, url)))
+}
+
+// ArticleIDFromURL extracts the per-site article id from an article URL: the
+// numeric id on HLTV, the slug on Cybersport
+func ArticleIDFromURL(source, url string) string {
+	switch source {
+	case "hltv":
+		if m := hltvURLRe.FindStringSubmatch(url); m != nil {
+			return m[1]
+		}
+	case "cybersport":
+		if m := cybersportURLRe.FindStringSubmatch(url); m != nil {
+			return m[2]
+		}
+	}
+	return ""
+}
+
+func cybersportTagFromURL(url string) string {
+	if m := cybersportURLRe.FindStringSubmatch(url); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// NewParsedRecord builds the canonical record of an extracted article
+func NewParsedRecord(docID string, article *Article, rawHash string) *ParsedRecord {
+	paragraphs := article.Paragraphs
+	if paragraphs == nil {
+		paragraphs = []string{}
+	}
+	return &ParsedRecord{
+		DocID:            docID,
+		Source:           article.Source,
+		URL:              article.URL,
+		Title:            article.Title,
+		Lead:             article.Lead,
+		Paragraphs:       paragraphs,
+		Metadata:         article.Metadata,
+		Extractor:        article.Extractor,
+		ExtractorVersion: ExtractorVersion,
+		RawHash:          rawHash,
+		ParsedAt:         time.Now().UTC(),
+	}
+}
+
+// Body returns the lead and paragraphs as one text
+func (r *ParsedRecord) Body() string {
+	return joinArticleText(r.Lead, r.Paragraphs)
+}
+
+// RenderText renders the plain-text view of a record used by the C++ tools:
+// the title, a blank line and the body
+func RenderText(title, body string) string {
+	return fmt.Sprintf("%s\n\n%s\n", title, body)
+}
+
+func joinArticleText(lead string, paragraphs []string) string {
+	if lead == "" {
+		return joinParagraphs(paragraphs)
+	}
+	return joinParagraphs(append([]string{lead}, paragraphs...))
+}
+
+// extractMetadata reads publication date, author, canonical URL and tags
+// from the page head and article header
+func extractMetadata(doc *goquery.Document) ArticleMetadata {
+	var meta ArticleMetadata
+
+	meta.Canonical = strings.TrimSpace(doc.Find("link[rel='canonical']").AttrOr("href", ""))
+
+	meta.Published = doc.Find("meta[property='article:published_time']").AttrOr("content", "")
+	if meta.Published == "" {
+		if unix, ok := doc.Find("[data-unix]").First().Attr("data-unix"); ok {
+			if ms, err := strconv.ParseInt(unix, 10, 64); err == nil {
+				meta.Published = time.UnixMilli(ms).UTC().Format(time.RFC3339)
+			}
+		}
+	}
+
+	meta.Author = strings.TrimSpace(doc.Find("meta[name='author']").AttrOr("content", ""))
+	if meta.Author == "" {
+		meta.Author = strings.TrimSpace(doc.Find(".article-info .author, [rel='author']").First().Text())
+	}
+
+	seen := make(map[string]bool)
+	addTag := func(tag string) {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	doc.Find("meta[property='article:tag']").Each(func(_ int, s *goquery.Selection) {
+		addTag(s.AttrOr("content", ""))
+	})
+	doc.Find(".tags_list a, .article-tags a").Each(func(_ int, s *goquery.Selection) {
+		addTag(s.Text())
+	})
+
+	return meta
+}
+
+// RecoverSourceURL finds the URL a raw page was fetched from: the canonical
+// link of the page, else the slug recorded in the links CSV, else whatever
+// the file name alone gives
+func RecoverSourceURL(source, rawName, html string, hltvSlugs map[string]string) string {
+	if m := canonicalRe.FindStringSubmatch(html); m != nil {
+		return m[1]
+	}
+
+	name := strings.TrimSuffix(rawName, ".html")
+	if source == "cybersport" {
+		if parts := strings.SplitN(name, "__", 2); len(parts) == 2 {
+			return BuildCybersportURL(parts[0], parts[1])
+		}
+		return ""
+	}
+
+	slug := hltvSlugs[name]
+	if slug == "" {
+		slug = "article"
+	}
+	return BuildHLTVURL(name, slug)
+}
+
+// LoadHLTVSlugs maps HLTV article ids to slugs from the links CSV, if present
+func LoadHLTVSlugs(corpusDir string) map[string]string {
+	slugs := make(map[string]string)
+	links, err := ReadHLTVCSV(filepath.Join(corpusDir, "hltv_links.csv"))
+	if err != nil {
+		return slugs
+	}
+	for _, l := range links {
+		slugs[l["id"]] = l["slug"]
+	}
+	return slugs
+}
+
+// JSONLDir returns the shard directory of a source
+func JSONLDir(corpusDir, source string) string {
+	return filepath.Join(corpusDir, source, "jsonl")
+}
+
+// ReadRecords loads every record from the JSONL shards in dir, keyed by doc id
+func ReadRecords(dir string) (map[string]*ParsedRecord, error) {
+	records := make(map[string]*ParsedRecord)
+	err := ForEachRecord(dir, func(r *ParsedRecord) error {
+		records[r.DocID] = r
+		return nil
+	})
+	return records, err
+}
+
+// ForEachRecord streams the records of all shards in dir in shard order
+func ForEachRecord(dir string, fn func(*ParsedRecord) error) error {
+	shards, err := filepath.Glob(filepath.Join(dir, "part-*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(shards)
+
+	for _, shard := range shards {
+		if err := forEachShardRecord(shard, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forEachShardRecord(path string, fn func(*ParsedRecord) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r ParsedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := fn(&r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// WriteRecords replaces the shards in dir with the given records, sorted by
+// doc id and split every RecordsPerShard records
+func WriteRecords(dir string, records map[string]*ParsedRecord) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var written []string
+	for start := 0; start < len(ids); start += RecordsPerShard {
+		end := start + RecordsPerShard
+		if end > len(ids) {
+			end = len(ids)
+		}
+		name := fmt.Sprintf("part-%05d.jsonl", start/RecordsPerShard)
+		if err := writeShard(filepath.Join(dir, name), ids[start:end], records); err != nil {
+			return err
+		}
+		written = append(written, name)
+	}
+
+	// Drop shards left over from a larger previous run
+	old, _ := filepath.Glob(filepath.Join(dir, "part-*.jsonl"))
+	for _, path := range old {
+		keep := false
+		for _, name := range written {
+			if filepath.Base(path) == name {
+				keep = true
+				break
+			}
+		}
+		if !keep {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+func writeShard(path string, ids []string, records map[string]*ParsedRecord) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, id := range ids {
+		if err := enc.Encode(records[id]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type ReparseOptions struct {
+	Source  string
+	Workers int
+	Force   bool
+	// Listeners follow the parsed articles written by the run
+	Listeners []ParsedListener
+}
+
+type reparseResult struct {
+	url    string
+	record *ParsedRecord
+	err    error
+}
+
+// ReparseDocuments extracts every stored document into the parsed articles
+// of the store. Unless opts.Force is set, documents whose parsed record has
+// the same raw hash and extractor version are skipped.
+func ReparseDocuments(store DocumentStore, opts ReparseOptions) (*ParseSummary, error) {
+	source := opts.Source
+	if source == "" {
+		source = "all"
+	}
+	summary := &ParseSummary{
+		Source:     source,
+		Strategies: make(map[string]int),
+		Reasons:    make(map[string]int),
+	}
+
+	current := make(map[string]string)
+	if !opts.Force {
+		err := store.ForEachParsed(func(r *ParsedRecord) error {
+			if r.ExtractorVersion == ExtractorVersion {
+				current[r.URL] = r.RawHash
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parsed articles: %w", err)
+		}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	writer := NewBatchWriter(store, 500, 0)
+	for _, l := range opts.Listeners {
+		writer.AddListener(l)
+	}
+	jobs := make(chan *Document)
+	results := make(chan reparseResult)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for doc := range jobs {
+				res := reparseResult{url: doc.URL}
+				article, err := ParseArticleFromHTML(doc.Source, doc.RawHTML, doc.URL)
+				if err != nil {
+					res.err = err
+				} else {
+					res.record = NewParsedRecord(DocIDFromURL(doc.Source, doc.URL), article, doc.HTMLHash)
+				}
+				results <- res
+			}
+		}()
+	}
+
+	var feedErr error
+	go func() {
+		feedErr = store.ForEach(func(doc *Document) error {
+			if opts.Source != "" && doc.Source != opts.Source {
+				return nil
+			}
+			summary.Total++
+			if hash, ok := current[doc.URL]; ok && hash == doc.HTMLHash {
+				summary.Skipped++
+				return nil
+			}
+			jobs <- doc
+			return nil
+		})
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if res.err == nil {
+			summary.Parsed++
+			summary.Strategies[res.record.Extractor]++
+			writer.SaveParsed(res.record)
+			continue
+		}
+
+		writer.DropParsed(res.url)
+		status := ParseFailed
+		var empty *EmptyArticleError
+		if errors.As(res.err, &empty) {
+			status = ParseEmpty
+			summary.Empty++
+		} else {
+			summary.Failed++
+		}
+		summary.Reasons[reasonDetails.ReplaceAllString(res.err.Error(), "")]++
+		summary.Failures = append(summary.Failures, ParseFailure{File: res.url, Status: status, Reason: res.err.Error()})
+	}
+
+	sort.Slice(summary.Failures, func(i, j int) bool { return summary.Failures[i].File < summary.Failures[j].File })
+
+	if err := writer.Close(); err != nil {
+		return summary, err
+	}
+	if feedErr != nil {
+		return summary, fmt.Errorf("failed to read documents: %w", feedErr)
+	}
+	summary.Records = summary.Parsed + summary.Skipped
+	return summary, nil
+}
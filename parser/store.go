@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+)
+
+// Document store backends selectable with db.backend
+const (
+	StoreMongo = "mongo"
+	StoreBolt  = "bolt"
+)
+
+// DocumentStore keeps the raw HTML of crawled pages keyed by normalized URL,
+// together with the bookkeeping needed for incremental re-crawls
+type DocumentStore interface {
+	// SaveDocument makes rawHTML the current version of the document and
+	// records it in the version history if it differs from the last capture
+	SaveDocument(normalizedURL, rawHTML, source string) error
+	DocumentExists(normalizedURL string) (bool, error)
+	// GetDocument returns nil without error when the URL is unknown
+	GetDocument(normalizedURL string) (*Document, error)
+	// GetDocumentHashes returns the html_hash of each known URL, without
+	// loading the documents themselves
+	GetDocumentHashes(normalizedURLs []string) (map[string]string, error)
+	// WriteDocuments applies a batch of saves and touches in as few round
+	// trips as the backend allows
+	WriteDocuments(writes []DocumentWrite) error
+	HasDocumentChanged(normalizedURL, newHTML string) (bool, error)
+	GetDocumentsForReCrawl(reCrawlInterval int) ([]Document, error)
+	UpdateLastChecked(normalizedURL string) error
+	// GetRawVersion returns the raw HTML of a version by its RawRef, or ""
+	// when it is not stored
+	GetRawVersion(rawRef string) (string, error)
+	GetLastProcessedURL() (string, error)
+	// ForEach calls fn for every stored document until fn returns an error
+	ForEach(fn func(*Document) error) error
+	// ForEachMatching is ForEach over the documents passing filter, which
+	// the backend applies before loading them where it can
+	ForEachMatching(filter DocumentFilter, fn func(*Document) error) error
+
+	// SaveParsed upserts extracted articles, keyed by the URL of the
+	// document they were parsed from
+	SaveParsed(records []*ParsedRecord) error
+	// GetParsed returns nil without error when the URL was never parsed
+	GetParsed(normalizedURL string) (*ParsedRecord, error)
+	ForEachParsed(fn func(*ParsedRecord) error) error
+	// DeleteParsed drops the parsed articles of documents that no longer
+	// extract
+	DeleteParsed(normalizedURLs []string) error
+
+	Close() error
+}
+
+// DocumentFilter narrows ForEachMatching; zero fields do not filter
+type DocumentFilter struct {
+	Source string
+	From   time.Time // crawl_time lower bound
+	To     time.Time // crawl_time upper bound, exclusive
+}
+
+// Matches reports whether a document of source crawled at crawlTime passes
+func (f DocumentFilter) Matches(source string, crawlTime int64) bool {
+	if f.Source != "" && source != f.Source {
+		return false
+	}
+	if !f.From.IsZero() && crawlTime < f.From.Unix() {
+		return false
+	}
+	if !f.To.IsZero() && crawlTime >= f.To.Unix() {
+		return false
+	}
+	return true
+}
+
+// OpenDocumentStore opens the backend selected in the db config section
+func OpenDocumentStore(cfg DBConfig) (DocumentStore, error) {
+	switch cfg.Backend {
+	case StoreMongo, "":
+		return NewMongoStore(cfg.URI, cfg.Database, cfg.Collection, cfg.ParsedCollection)
+	case StoreBolt:
+		return NewBoltStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown db backend: %s", cfg.Backend)
+	}
+}
+
+// DescribeStore names the store for log output
+func DescribeStore(cfg DBConfig) string {
+	if cfg.Backend == StoreBolt {
+		return "bolt store " + cfg.Path
+	}
+	return "MongoDB"
+}
+
+func documentChanged(store DocumentStore, normalizedURL, newHTML string) (bool, error) {
+	hashes, err := store.GetDocumentHashes([]string{normalizedURL})
+	if err != nil {
+		return false, err
+	}
+	hash, ok := hashes[normalizedURL]
+	if !ok || newHTML == "" {
+		return true, nil
+	}
+
+	return hash != computeHTMLHash(newHTML), nil
+}
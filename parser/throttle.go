@@ -0,0 +1,305 @@
+package parser
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ThrottleConfig struct {
+	InitialRate    float64 `yaml:"initial_rate"`
+	MinRate        float64 `yaml:"min_rate"`
+	MaxRate        float64 `yaml:"max_rate"`
+	RateStep       float64 `yaml:"rate_step"`
+	MaxConcurrency int     `yaml:"max_concurrency"`
+	LatencyFactor  float64 `yaml:"latency_factor"`
+}
+
+type ThrottleStats struct {
+	Host          string  `json:"host"`
+	Rate          float64 `json:"rate_per_second"`
+	Concurrency   int     `json:"concurrency"`
+	AvgLatencyMs  int64   `json:"avg_latency_ms"`
+	Requests      int     `json:"requests"`
+	Throttled     int     `json:"throttled"`
+	SlowResponses int     `json:"slow_responses"`
+	Decreases     int     `json:"decreases"`
+}
+
+// HostThrottle is an AIMD controller for the requests sent to a single host.
+// Healthy responses raise the rate and concurrency additively, 429/503 and
+// latency spikes cut them multiplicatively.
+type HostThrottle struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	cfg  ThrottleConfig
+	host string
+
+	rate        float64
+	limit       int
+	inFlight    int
+	nextSlot    time.Time
+	pausedUntil time.Time
+
+	latency      time.Duration
+	baseline     time.Duration
+	successes    int
+	backoffs     int
+	lastDecrease time.Time
+
+	stats ThrottleStats
+}
+
+type ThrottleController struct {
+	mu    sync.Mutex
+	cfg   ThrottleConfig
+	hosts map[string]*HostThrottle
+}
+
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		InitialRate:    2,
+		MinRate:        0.2,
+		MaxRate:        10,
+		RateStep:       0.25,
+		MaxConcurrency: 8,
+		LatencyFactor:  2.5,
+	}
+}
+
+func NewThrottleController(cfg ThrottleConfig) *ThrottleController {
+	def := DefaultThrottleConfig()
+	if cfg.MinRate <= 0 {
+		cfg.MinRate = def.MinRate
+	}
+	if cfg.MaxRate <= 0 {
+		cfg.MaxRate = def.MaxRate
+	}
+	if cfg.InitialRate <= 0 {
+		cfg.InitialRate = def.InitialRate
+	}
+	if cfg.InitialRate < cfg.MinRate {
+		cfg.InitialRate = cfg.MinRate
+	}
+	if cfg.InitialRate > cfg.MaxRate {
+		cfg.InitialRate = cfg.MaxRate
+	}
+	if cfg.RateStep <= 0 {
+		cfg.RateStep = def.RateStep
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = def.MaxConcurrency
+	}
+	if cfg.LatencyFactor <= 1 {
+		cfg.LatencyFactor = def.LatencyFactor
+	}
+
+	return &ThrottleController{
+		cfg:   cfg,
+		hosts: make(map[string]*HostThrottle),
+	}
+}
+
+// Host returns the controller for a host, creating it on first use
+func (c *ThrottleController) Host(host string) *HostThrottle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.hosts[host]
+	if !ok {
+		h = &HostThrottle{
+			cfg:   c.cfg,
+			host:  host,
+			rate:  c.cfg.InitialRate,
+			limit: 1,
+		}
+		h.cond = sync.NewCond(&h.mu)
+		h.stats.Host = host
+		c.hosts[host] = h
+	}
+	return h
+}
+
+// Snapshot returns the current state of every known host, sorted by host
+func (c *ThrottleController) Snapshot() []ThrottleStats {
+	c.mu.Lock()
+	hosts := make([]*HostThrottle, 0, len(c.hosts))
+	for _, h := range c.hosts {
+		hosts = append(hosts, h)
+	}
+	c.mu.Unlock()
+
+	var res []ThrottleStats
+	for _, h := range hosts {
+		res = append(res, h.Stats())
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Host < res[j].Host })
+	return res
+}
+
+// Acquire blocks until the host has a free concurrency slot and the next
+// rate slot (or Retry-After pause) has passed
+func (h *HostThrottle) Acquire() {
+	h.mu.Lock()
+	for h.inFlight >= h.limit {
+		h.cond.Wait()
+	}
+	h.inFlight++
+
+	now := time.Now()
+	slot := now
+	if h.nextSlot.After(slot) {
+		slot = h.nextSlot
+	}
+	if h.pausedUntil.After(slot) {
+		slot = h.pausedUntil
+	}
+	h.nextSlot = slot.Add(time.Duration(float64(time.Second) / h.rate))
+	h.stats.Requests++
+	h.mu.Unlock()
+
+	if wait := time.Until(slot); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Release returns the slot taken by Acquire and feeds the response back into
+// the controller. status is 0 when no HTTP status is available, which leaves
+// the rate alone (browser fetches); network errors go through ReleaseFailed.
+func (h *HostThrottle) Release(status int, latency, retryAfter time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.inFlight--
+	h.cond.Broadcast()
+
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		h.stats.Throttled++
+		h.backoffs++
+
+		pause := retryAfter
+		if pause <= 0 {
+			pause = time.Duration(2<<uint(min(h.backoffs-1, 5))) * time.Second
+		}
+		if until := time.Now().Add(pause); until.After(h.pausedUntil) {
+			h.pausedUntil = until
+		}
+		h.decrease(fmt.Sprintf("got %d, pausing %v", status, pause.Round(time.Second)))
+		return
+	}
+
+	if status != 0 && status != http.StatusOK {
+		return
+	}
+	if latency <= 0 {
+		return
+	}
+
+	h.backoffs = 0
+	if h.latency == 0 {
+		h.latency = latency
+	} else {
+		h.latency = (h.latency*4 + latency) / 5
+	}
+	if h.baseline == 0 || h.latency < h.baseline {
+		h.baseline = h.latency
+	}
+
+	if float64(h.latency) > float64(h.baseline)*h.cfg.LatencyFactor {
+		h.stats.SlowResponses++
+		h.decrease(fmt.Sprintf("latency %v (baseline %v)", h.latency.Round(time.Millisecond), h.baseline.Round(time.Millisecond)))
+		// Let the baseline drift up so a permanently slower host is not
+		// punished forever
+		h.baseline = (h.baseline*3 + h.latency) / 4
+		return
+	}
+
+	h.successes++
+	if h.successes < h.limit {
+		return
+	}
+	h.successes = 0
+
+	h.rate += h.cfg.RateStep
+	if h.rate > h.cfg.MaxRate {
+		h.rate = h.cfg.MaxRate
+	}
+	if h.limit < h.cfg.MaxConcurrency {
+		h.limit++
+		h.cond.Broadcast()
+		fmt.Printf("[throttle] %s: healthy, rate %.2f req/s, concurrency %d\n", h.host, h.rate, h.limit)
+	}
+}
+
+// ReleaseFailed returns the slot of a request that got no response at all.
+// Timeouts and resets usually mean an overloaded host, so the rate is cut
+// like for a latency spike. There is no pause: no server asked for one.
+func (h *HostThrottle) ReleaseFailed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.inFlight--
+	h.cond.Broadcast()
+	h.decrease(fmt.Sprintf("request failed (%v)", err))
+}
+
+// decrease halves rate and concurrency at most once per congestion event.
+// Callers must hold h.mu.
+func (h *HostThrottle) decrease(reason string) {
+	h.successes = 0
+
+	window := time.Duration(float64(time.Second) / h.rate)
+	if window < time.Second {
+		window = time.Second
+	}
+	if time.Since(h.lastDecrease) < window {
+		return
+	}
+	h.lastDecrease = time.Now()
+
+	h.rate /= 2
+	if h.rate < h.cfg.MinRate {
+		h.rate = h.cfg.MinRate
+	}
+	h.limit /= 2
+	if h.limit < 1 {
+		h.limit = 1
+	}
+	h.stats.Decreases++
+
+	fmt.Printf("[throttle] %s: %s; rate %.2f req/s, concurrency %d\n", h.host, reason, h.rate, h.limit)
+}
+
+func (h *HostThrottle) Stats() ThrottleStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.stats
+	s.Rate = h.rate
+	s.Concurrency = h.limit
+	s.AvgLatencyMs = h.latency.Milliseconds()
+	return s
+}
+
+// ParseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
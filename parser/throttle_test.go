@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestThrottle() *HostThrottle {
+	return NewThrottleController(ThrottleConfig{InitialRate: 4, MinRate: 0.5, MaxRate: 5, RateStep: 0.5, MaxConcurrency: 3}).Host("example.com")
+}
+
+func TestThrottleAdditiveIncrease(t *testing.T) {
+	h := newTestThrottle()
+	steps := []struct {
+		rate  float64
+		limit int
+	}{
+		// One healthy response per slot raises rate and concurrency by a step
+		{4.5, 2},
+		{4.5, 2},
+		{5, 3},
+		{5, 3}, {5, 3},
+		// Capped at MaxRate and MaxConcurrency
+		{5, 3},
+	}
+	for i, want := range steps {
+		h.Release(http.StatusOK, 100*time.Millisecond, 0)
+		if h.rate != want.rate || h.limit != want.limit {
+			t.Fatalf("after %d responses rate %.2f limit %d, want %.2f and %d", i+1, h.rate, h.limit, want.rate, want.limit)
+		}
+	}
+}
+
+func TestThrottleMultiplicativeDecrease(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		h := newTestThrottle()
+		h.limit = 3
+		h.Release(status, 0, 0)
+		if h.rate != 2 || h.limit != 1 {
+			t.Errorf("%d: rate %.2f limit %d, want 2 and 1", status, h.rate, h.limit)
+		}
+		// A burst of 429s is one congestion event
+		h.Release(status, 0, 0)
+		if h.rate != 2 || h.stats.Decreases != 1 {
+			t.Errorf("%d: second response in the window cut again: rate %.2f, %d decreases", status, h.rate, h.stats.Decreases)
+		}
+		if h.stats.Throttled != 2 {
+			t.Errorf("%d: counted %d throttled responses, want 2", status, h.stats.Throttled)
+		}
+	}
+
+	// Other errors and statusless releases leave the rate alone
+	h := newTestThrottle()
+	h.Release(http.StatusNotFound, 100*time.Millisecond, 0)
+	h.Release(0, 0, 0)
+	if h.rate != 4 || h.stats.Decreases != 0 {
+		t.Errorf("rate %.2f after 404 and browser release, want 4", h.rate)
+	}
+
+	// Network errors back off, without pausing the host
+	h.ReleaseFailed(errors.New("connection reset"))
+	if h.rate != 2 || !h.pausedUntil.IsZero() {
+		t.Errorf("after a network error rate %.2f paused until %v, want 2 and no pause", h.rate, h.pausedUntil)
+	}
+}
+
+func TestThrottlePause(t *testing.T) {
+	h := newTestThrottle()
+	h.Release(http.StatusTooManyRequests, 0, 30*time.Second)
+	if d := time.Until(h.pausedUntil); d < 29*time.Second || d > 30*time.Second {
+		t.Errorf("Retry-After 30s paused for %v", d)
+	}
+
+	// Without Retry-After the pause doubles per backoff, up to 64s
+	h = newTestThrottle()
+	for _, want := range []time.Duration{2, 4, 8, 16, 32, 64, 64} {
+		h.pausedUntil = time.Time{}
+		h.Release(http.StatusServiceUnavailable, 0, 0)
+		if d := time.Until(h.pausedUntil); d < want*time.Second-time.Second || d > want*time.Second {
+			t.Errorf("backoff %d paused for %v, want %v", h.backoffs, d, want*time.Second)
+		}
+	}
+
+	// A healthy response resets the backoff
+	h.Release(http.StatusOK, 100*time.Millisecond, 0)
+	h.pausedUntil = time.Time{}
+	h.Release(http.StatusServiceUnavailable, 0, 0)
+	if d := time.Until(h.pausedUntil); d > 2*time.Second {
+		t.Errorf("pause after recovery %v, want 2s", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 120 * time.Second, 120 * time.Second},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 88 * time.Second, 90 * time.Second},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+		{"soon", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v..%v", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"math/rand"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -28,19 +29,53 @@ func SleepWithJitter(base time.Duration, attempt int) {
 	time.Sleep(wait)
 }
 
-// ExtractDomain extracts domain from URL
+// ExtractDomain extracts the domain of a configured site from URL
 func ExtractDomain(urlStr string) string {
-	if strings.Contains(urlStr, "hltv.org") {
-		return "hltv.org"
-	}
-	if strings.Contains(urlStr, "cybersport.ru") {
-		return "cybersport.ru"
+	for _, base := range []string{HLTVBaseURL, CybersportBaseURL} {
+		domain := strings.TrimPrefix(hostOf(base), "www.")
+		if domain != "" && strings.Contains(urlStr, domain) {
+			return domain
+		}
 	}
 	return ""
 }
 
+// SetBaseURLs overrides the site base URLs; empty values keep the current ones
+func SetBaseURLs(hltv, cybersport string) {
+	if hltv != "" {
+		HLTVBaseURL = strings.TrimRight(hltv, "/")
+	}
+	if cybersport != "" {
+		CybersportBaseURL = strings.TrimRight(cybersport, "/")
+	}
+}
+
+// hostOf returns the host part of a URL, or the URL itself if it can't be parsed
+func hostOf(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Hostname() == "" {
+		return urlStr
+	}
+	return u.Hostname()
+}
+
+// EmptyArticleError is returned when extraction produced no usable title or text
+type EmptyArticleError struct {
+	Reason string
+}
+
+func (e *EmptyArticleError) Error() string {
+	return e.Reason
+}
+
 // IsEmptyHLTVArticle checks if article is valid
 func IsEmptyHLTVArticle(article *Article) error {
+	return IsEmptyArticle(article)
+}
+
+// IsEmptyArticle checks that an extracted article of any source has a title
+// and real content rather than an anti-bot page
+func IsEmptyArticle(article *Article) error {
 	if article == nil {
 		return fmt.Errorf("article is nil")
 	}
@@ -49,11 +84,11 @@ func IsEmptyHLTVArticle(article *Article) error {
 	content := strings.TrimSpace(article.Content)
 
 	if title == "" {
-		return fmt.Errorf("empty title")
+		return &EmptyArticleError{Reason: "empty title"}
 	}
 
 	if len(content) < 15 {
-		return fmt.Errorf("content too short (%d chars)", len(content))
+		return &EmptyArticleError{Reason: fmt.Sprintf("content too short (%d chars)", len(content))}
 	}
 
 	badMarkers := []string{
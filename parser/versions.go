@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DocumentVersion is one distinct capture of a page. The raw HTML lives in
+// the content-addressed raw storage of the store under RawRef.
+type DocumentVersion struct {
+	Hash      string `bson:"hash" json:"hash"`
+	FetchedAt int64  `bson:"fetched_at" json:"fetched_at"`
+	RawRef    string `bson:"raw_ref" json:"raw_ref"`
+	Size      int    `bson:"size" json:"size"`
+}
+
+// appendVersion returns the version list of prev extended by a capture of
+// rawHTML. Documents saved before versioning existed get their stored capture
+// as the first version, returned in seed so its raw content can be kept too.
+// added is false when rawHTML is already the current version.
+func appendVersion(prev *Document, rawHTML, hash string, fetchedAt int64) (versions []DocumentVersion, seed *DocumentVersion, added bool) {
+	if prev != nil {
+		versions = append(versions, prev.Versions...)
+		if len(versions) == 0 && prev.RawHTML != "" {
+			seed = &DocumentVersion{
+				Hash:      prev.HTMLHash,
+				FetchedAt: prev.CrawlTime,
+				RawRef:    prev.HTMLHash,
+				Size:      len(prev.RawHTML),
+			}
+			versions = append(versions, *seed)
+		}
+	}
+
+	if len(versions) > 0 && versions[len(versions)-1].Hash == hash {
+		return versions, seed, false
+	}
+
+	versions = append(versions, DocumentVersion{
+		Hash:      hash,
+		FetchedAt: fetchedAt,
+		RawRef:    hash,
+		Size:      len(rawHTML),
+	})
+	return versions, seed, true
+}
+
+// DocumentVersions returns the captures of a document, oldest first
+func DocumentVersions(doc *Document) []DocumentVersion {
+	if len(doc.Versions) > 0 {
+		return doc.Versions
+	}
+	return []DocumentVersion{{Hash: doc.HTMLHash, FetchedAt: doc.CrawlTime, RawRef: doc.HTMLHash, Size: len(doc.RawHTML)}}
+}
+
+// VersionHTML loads the raw HTML of one version of doc
+func VersionHTML(store DocumentStore, doc *Document, v DocumentVersion) (string, error) {
+	if v.Hash == doc.HTMLHash && doc.RawHTML != "" {
+		return doc.RawHTML, nil
+	}
+	html, err := store.GetRawVersion(v.RawRef)
+	if err != nil {
+		return "", err
+	}
+	if html == "" {
+		return "", fmt.Errorf("raw content %s is missing", v.RawRef)
+	}
+	return html, nil
+}
+
+// VersionText extracts the article of one version and renders it as text.
+// Pages the extractor rejects are shown with the extraction error, so a diff
+// still shows when an article was emptied or blocked.
+func VersionText(store DocumentStore, doc *Document, v DocumentVersion) (string, error) {
+	html, err := VersionHTML(store, doc, v)
+	if err != nil {
+		return "", err
+	}
+	article, err := ParseArticleFromHTML(doc.Source, html, doc.URL)
+	if err != nil {
+		return fmt.Sprintf("[extraction failed: %v]\n", err), nil
+	}
+	return RenderText(article.Title, article.Content), nil
+}
+
+// Diff operations
+const (
+	DiffEqual  = ' '
+	DiffDelete = '-'
+	DiffInsert = '+'
+)
+
+type DiffLine struct {
+	Op   byte
+	Text string
+}
+
+// DiffLines computes a line diff of a and b from their longest common
+// subsequence
+func DiffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffDelete, a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diff = append(diff, DiffLine{DiffDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		diff = append(diff, DiffLine{DiffInsert, b[j]})
+	}
+	return diff
+}
+
+// FormatDiff renders a diff with the given number of context lines around
+// each change. Unchanged stretches beyond that are collapsed.
+func FormatDiff(diff []DiffLine, context int) string {
+	var b strings.Builder
+	lastShown := -1
+	for i, line := range diff {
+		if line.Op == DiffEqual && !nearChange(diff, i, context) {
+			continue
+		}
+		if lastShown >= 0 && i > lastShown+1 || lastShown < 0 && i > 0 {
+			b.WriteString("@@\n")
+		}
+		b.WriteByte(line.Op)
+		b.WriteByte(' ')
+		b.WriteString(line.Text)
+		b.WriteByte('\n')
+		lastShown = i
+	}
+	return b.String()
+}
+
+func nearChange(diff []DiffLine, i, context int) bool {
+	for k := i - context; k <= i+context; k++ {
+		if k >= 0 && k < len(diff) && diff[k].Op != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
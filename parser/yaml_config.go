@@ -8,11 +8,9 @@ import (
 )
 
 type YAMLConfig struct {
-	DB struct {
-		URI        string `yaml:"uri"`
-		Database   string `yaml:"database"`
-		Collection string `yaml:"collection"`
-	} `yaml:"db"`
+	DB     DBConfig     `yaml:"db"`
+	Index  IndexConfig  `yaml:"index,omitempty"`
+	Search SearchConfig `yaml:"search,omitempty"`
 
 	Logic struct {
 		DelayBetweenPages int `yaml:"delay_between_pages"`
@@ -21,15 +19,75 @@ type YAMLConfig struct {
 
 	Browser struct {
 		UseBrowser   bool `yaml:"use_browser"`
+		Hybrid       bool `yaml:"hybrid"`
 		ShowBrowser  bool `yaml:"show_browser"`
 		BrowserDebug bool `yaml:"browser_debug"`
 	} `yaml:"browser,omitempty"`
 
+	Throttle ThrottleConfig `yaml:"throttle,omitempty"`
+	Breaker  BreakerConfig  `yaml:"breaker,omitempty"`
+	Cassette CassetteConfig `yaml:"cassette,omitempty"`
+
+	Sites struct {
+		HLTV       SiteConfig `yaml:"hltv"`
+		Cybersport SiteConfig `yaml:"cybersport"`
+	} `yaml:"sites,omitempty"`
+
 	Workers int `yaml:"workers,omitempty"`
 
 	Site string `yaml:"site,omitempty"`
 }
 
+// DBConfig selects the document store. Backend "mongo" uses URI, Database
+// and Collection, backend "bolt" keeps everything in the single file at Path.
+type DBConfig struct {
+	Backend    string `yaml:"backend"`
+	Path       string `yaml:"path"`
+	URI        string `yaml:"uri"`
+	Database   string `yaml:"database"`
+	Collection string `yaml:"collection"`
+	BatchSize  int    `yaml:"batch_size"`
+
+	ParsedCollection string `yaml:"parsed_collection"`
+}
+
+// IndexConfig places the Go search index. With Live set the crawler updates
+// it as pages are saved; otherwise run the index command. Entities maps the
+// canonical name of a team or player to its aliases for the entity facet.
+type IndexConfig struct {
+	Path     string              `yaml:"path"`
+	Live     bool                `yaml:"live"`
+	Entities map[string][]string `yaml:"entities"`
+}
+
+// SearchConfig tunes ranked search. Fields holds BM25F weights by field
+// name (title, lead, body, tags, source); missing fields keep the defaults.
+type SearchConfig struct {
+	BM25 struct {
+		K1 float64 `yaml:"k1"`
+		B  float64 `yaml:"b"`
+	} `yaml:"bm25"`
+	Fields   map[string]float64 `yaml:"fields"`
+	Snippets SnippetConfig      `yaml:"snippets"`
+}
+
+// SnippetConfig sizes result snippets. Markers overrides the highlight
+// markers per output style: terminal, html or json.
+type SnippetConfig struct {
+	Passages int                     `yaml:"passages"`
+	Window   int                     `yaml:"window"`
+	Markers  map[string]MarkerConfig `yaml:"markers"`
+}
+
+type MarkerConfig struct {
+	Pre  string `yaml:"pre"`
+	Post string `yaml:"post"`
+}
+
+type SiteConfig struct {
+	BaseURL string `yaml:"base_url"`
+}
+
 func LoadYAMLConfig(configPath string) (*YAMLConfig, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -37,6 +95,9 @@ func LoadYAMLConfig(configPath string) (*YAMLConfig, error) {
 	}
 
 	var config YAMLConfig
+	// b = 0 is a valid setting, so BM25 defaults are set before decoding
+	config.Search.BM25.K1 = 1.2
+	config.Search.BM25.B = 0.75
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
@@ -44,6 +105,27 @@ func LoadYAMLConfig(configPath string) (*YAMLConfig, error) {
 	if config.Logic.DelayBetweenPages <= 0 {
 		config.Logic.DelayBetweenPages = 500
 	}
+	if config.DB.Backend == "" {
+		config.DB.Backend = StoreMongo
+	}
+	if config.DB.ParsedCollection == "" {
+		config.DB.ParsedCollection = "parsed_articles"
+	}
+	if config.DB.BatchSize <= 0 {
+		config.DB.BatchSize = 200
+	}
+	if config.DB.Backend == StoreBolt && config.DB.Path == "" {
+		config.DB.Path = "corpus/documents.db"
+	}
+	if config.Index.Path == "" {
+		config.Index.Path = "corpus/index.db"
+	}
+	if config.Search.BM25.K1 <= 0 {
+		config.Search.BM25.K1 = 1.2
+	}
+	if config.Search.BM25.B < 0 || config.Search.BM25.B > 1 {
+		return nil, fmt.Errorf("search.bm25.b must be between 0 and 1")
+	}
 	if config.Workers <= 0 {
 		config.Workers = 4
 	}
@@ -1,4 +1,5 @@
 #include <cstdio>
+#include <cstdlib>
 #include <cstring>
 #include <dirent.h>
 #include "boolean_index.h"
@@ -14,28 +15,40 @@ int main(int argc, char* argv[]) {
 
     BooleanIndex index;
 
-    DIR* dir = opendir(corpus_dir);
-    if (!dir) {
+    // Files are indexed in name order, so doc IDs are reproducible and match
+    // the manifest of an "export -format indexed" directory
+    struct dirent** entries;
+    int n = scandir(corpus_dir, &entries, nullptr, alphasort);
+    if (n < 0) {
         fprintf(stderr, "Error opening directory: %s\n", corpus_dir);
         return 1;
     }
 
-    struct dirent* entry;
     unsigned int doc_count = 0;
 
-    while ((entry = readdir(dir)) != nullptr) {
-        if (entry->d_type != DT_REG) continue;
+    for (int i = 0; i < n; ++i) {
+        struct dirent* entry = entries[i];
+        if (entry->d_type != DT_REG) {
+            free(entry);
+            continue;
+        }
 
         char filepath[512];
         snprintf(filepath, sizeof(filepath), "%s/%s", corpus_dir, entry->d_name);
 
-        FILE* f = fopen(filepath, "r");
-        if (!f) continue;
+        free(entry);
 
+        // An unreadable file still takes its ID, as an empty document
         char buffer[65536];
-        size_t bytes_read = fread(buffer, 1, sizeof(buffer) - 1, f);
+        size_t bytes_read = 0;
+        FILE* f = fopen(filepath, "r");
+        if (f) {
+            bytes_read = fread(buffer, 1, sizeof(buffer) - 1, f);
+            fclose(f);
+        } else {
+            fprintf(stderr, "Error reading %s, indexed as empty\n", filepath);
+        }
         buffer[bytes_read] = '\0';
-        fclose(f);
 
         index.add_document(buffer);
         doc_count++;
@@ -45,7 +58,7 @@ int main(int argc, char* argv[]) {
         }
     }
 
-    closedir(dir);
+    free(entries);
 
     index.save_index(index_file);
 